@@ -0,0 +1,188 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+// Access log formats
+const (
+	// AccessLogStructured emits the fields as structured Logger fields
+	AccessLogStructured = "structured"
+	// AccessLogCombined emits the Apache combined log format
+	AccessLogCombined = "combined"
+	// AccessLogJSON emits the fields as a JSON object
+	AccessLogJSON = "json"
+)
+
+// Access log fields
+const (
+	AccessLogMethod    = "Method"
+	AccessLogRoute     = "Route"
+	AccessLogURL       = "URL"
+	AccessLogStatus    = "Status"
+	AccessLogDuration  = "Duration"
+	AccessLogBytes     = "Bytes"
+	AccessLogRemoteIP  = "RemoteIP"
+	AccessLogUserAgent = "UserAgent"
+	AccessLogIdentity  = "Identity"
+)
+
+const authAttribute = "auth"
+
+var defaultAccessLogFields = []string{
+	AccessLogMethod,
+	AccessLogRoute,
+	AccessLogStatus,
+	AccessLogDuration,
+	AccessLogBytes,
+	AccessLogRemoteIP,
+	AccessLogUserAgent,
+	AccessLogIdentity,
+}
+
+// AccessLogConfig contains the parameters for logging handled requests
+type AccessLogConfig struct {
+	// Format is one of AccessLogStructured (default), AccessLogCombined or
+	// AccessLogJSON
+	Format string
+	// Fields selects the fields of structured and JSON entries, defaults to
+	// all but AccessLogURL
+	Fields []string
+	// SkipPaths contains route templates or URL paths that don't get
+	// logged, e.g. health checks
+	SkipPaths []string
+	// SlowThreshold logs requests taking longer at Warn level
+	SlowThreshold time.Duration
+}
+
+func (c AccessLogConfig) skipped(request *restful.Request) bool {
+	for _, p := range c.SkipPaths {
+		if p == routeTemplate(request) || p == request.Request.URL.Path {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) loggingFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	start := time.Now()
+
+	resp.PrettyPrint(false)
+	chain.ProcessFilter(req, resp)
+	duration := time.Since(start)
+
+	config := s.Config.AccessLog
+	if req.Request.Method == optionsReqIdentifier || config.skipped(req) {
+		return
+	}
+
+	logger := requestLogger(req)
+	var msg string
+	switch config.Format {
+	case AccessLogCombined:
+		msg = s.combinedLogLine(req, resp, start)
+
+	case AccessLogJSON:
+		b, err := json.Marshal(s.accessLogFields(req, resp, duration))
+		if err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		msg = string(b)
+
+	default:
+		logger = logger.WithFields(s.accessLogFields(req, resp, duration))
+		msg = "Finished request"
+	}
+
+	if config.SlowThreshold > 0 && duration > config.SlowThreshold {
+		logger.Warn(msg)
+		return
+	}
+	logger.Info(msg)
+}
+
+// accessLogFields collects the configured fields for an access log entry
+func (s *Server) accessLogFields(req *restful.Request, resp *restful.Response, duration time.Duration) Fields {
+	names := s.Config.AccessLog.Fields
+	if len(names) == 0 {
+		names = defaultAccessLogFields
+	}
+
+	fields := Fields{}
+	for _, name := range names {
+		switch name {
+		case AccessLogMethod:
+			fields[name] = req.Request.Method
+		case AccessLogRoute:
+			fields[name] = routeTemplate(req)
+		case AccessLogURL:
+			fields[name] = redactAccessToken(req.Request.URL.String())
+		case AccessLogStatus:
+			fields[name] = resp.StatusCode()
+		case AccessLogDuration:
+			fields[name] = duration.String()
+		case AccessLogBytes:
+			fields[name] = resp.ContentLength()
+		case AccessLogRemoteIP:
+			fields[name] = ClientIP(req.Request, s.Config.TrustedProxies)
+		case AccessLogUserAgent:
+			fields[name] = req.Request.UserAgent()
+		case AccessLogIdentity:
+			if id := identity(req.Attribute(authAttribute)); id != "" {
+				fields[name] = id
+			}
+		}
+	}
+
+	return fields
+}
+
+// combinedLogLine formats a request in the Apache combined log format
+func (s *Server) combinedLogLine(req *restful.Request, resp *restful.Response, start time.Time) string {
+	user := identity(req.Attribute(authAttribute))
+	if user == "" {
+		user = "-"
+	}
+	bytes := "-"
+	if resp.ContentLength() > 0 {
+		bytes = strconv.Itoa(resp.ContentLength())
+	}
+
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s %q %q",
+		ClientIP(req.Request, s.Config.TrustedProxies),
+		user,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		req.Request.Method,
+		redactAccessToken(req.Request.RequestURI),
+		req.Request.Proto,
+		resp.StatusCode(),
+		bytes,
+		req.Request.Referer(),
+		req.Request.UserAgent())
+}
+
+// routeTemplate returns the path template of the route handling req, or the
+// URL path if no route matched
+func routeTemplate(req *restful.Request) string {
+	if p := req.SelectedRoutePath(); p != "" {
+		if len(p) > 1 {
+			p = strings.TrimSuffix(p, "/")
+		}
+		return p
+	}
+	return req.Request.URL.Path
+}
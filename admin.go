@@ -0,0 +1,227 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+// Admin is a Container with debugging and administration endpoints for a
+// Server. It implements http.Handler, so it can be served on a separate
+// listener, or it can be mounted below a prefix of another Container.
+//
+// All requests are authenticated by the APIContextFactory passed to NewAdmin
+// and rejected unless Authentication returns a non-nil user.
+type Admin struct {
+	Container *restful.Container
+
+	server  *Server
+	context APIContextFactory
+}
+
+// RuntimeStats describes the state of the process and its Server
+type RuntimeStats struct {
+	GoVersion        string    `json:"goVersion"`
+	NumCPU           int       `json:"numCPU"`
+	Goroutines       int       `json:"goroutines"`
+	InFlightRequests int       `json:"inFlightRequests"`
+	ShuttingDown     bool      `json:"shuttingDown"`
+	Heap             HeapStats `json:"heap"`
+}
+
+// HeapStats is a summary of runtime.MemStats
+type HeapStats struct {
+	Alloc      uint64 `json:"alloc"`
+	TotalAlloc uint64 `json:"totalAlloc"`
+	Sys        uint64 `json:"sys"`
+	InUse      uint64 `json:"inUse"`
+	Objects    uint64 `json:"objects"`
+	NumGC      uint32 `json:"numGC"`
+	PauseTotal string `json:"pauseTotal"`
+}
+
+// LogLevel is the representation of the Logger's level
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+// NewAdmin creates the admin Container for server, authenticating all
+// requests with context. It mounts:
+//
+//	/pprof/    the net/http/pprof profiles
+//	/stats     goroutine and heap stats and the in-flight request count
+//	/config    the effective configuration with secrets masked
+//	/loglevel  the level of the configured Logger, changeable with PUT
+func NewAdmin(server *Server, context APIContextFactory) *Admin {
+	a := &Admin{
+		Container: restful.NewContainer(),
+		server:    server,
+		context:   context,
+	}
+	a.Container.Filter(server.requestIDFilter)
+	a.Container.Filter(a.authFilter)
+
+	ws := new(restful.WebService)
+	ws.Path("/pprof").
+		Doc("Profiling data in the format expected by the pprof tool").
+		Produces("*/*")
+	ws.Route(ws.GET("/").To(a.pprofIndex))
+	ws.Route(ws.GET("/cmdline").To(handlerRoute(pprof.Cmdline)))
+	ws.Route(ws.GET("/profile").To(handlerRoute(pprof.Profile)))
+	ws.Route(ws.GET("/symbol").To(handlerRoute(pprof.Symbol)))
+	ws.Route(ws.POST("/symbol").To(handlerRoute(pprof.Symbol)))
+	ws.Route(ws.GET("/trace").To(handlerRoute(pprof.Trace)))
+	ws.Route(ws.GET("/{profile}").To(pprofProfile).
+		Param(ws.PathParameter("profile", "Name of the profile, e.g. heap or goroutine").DataType("string")))
+	a.Container.Add(ws)
+
+	ws = new(restful.WebService)
+	ws.Path("/").
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("/stats").To(a.stats).
+		Doc("runtime stats").
+		Returns(http.StatusOK, "OK", RuntimeStats{}))
+	ws.Route(ws.GET("/config").To(a.config).
+		Doc("effective configuration with secrets masked").
+		Produces("text/plain"))
+	ws.Route(ws.GET("/loglevel").To(a.logLevel).
+		Doc("get the log level").
+		Returns(http.StatusOK, "OK", LogLevel{}).
+		Returns(http.StatusNotImplemented, "Logger doesn't support levels", ErrorResponse{}))
+	ws.Route(ws.PUT("/loglevel").To(a.setLogLevel).
+		Doc("change the log level").
+		Filter(bodyFilter(server.adminMaxBodySize())).
+		Reads(LogLevel{}).
+		Returns(http.StatusOK, "OK", LogLevel{}).
+		Returns(http.StatusBadRequest, "Invalid log level", ErrorResponse{}).
+		Returns(http.StatusRequestEntityTooLarge, "Request body too large", ErrorResponse{}).
+		Returns(http.StatusNotImplemented, "Logger doesn't support levels", ErrorResponse{}))
+	a.Container.Add(ws)
+
+	return a
+}
+
+// ServeHTTP implements net/http.Handler
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.Container.ServeHTTP(w, r)
+}
+
+// Mount serves the admin endpoints below prefix on container, e.g. "/admin"
+func (a *Admin) Mount(container *restful.Container, prefix string) {
+	prefix = "/" + strings.Trim(prefix, "/")
+	container.Handle(prefix+"/", http.StripPrefix(prefix, a))
+}
+
+func (a *Admin) authFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	if !a.server.authenticateAdmin(request, response, a.context) {
+		return
+	}
+
+	chain.ProcessFilter(request, response)
+}
+
+// handlerRoute adapts a net/http handler to a RouteFunction
+func handlerRoute(handler http.HandlerFunc) restful.RouteFunction {
+	return func(request *restful.Request, response *restful.Response) {
+		handler(response, request.Request)
+	}
+}
+
+func (a *Admin) pprofIndex(request *restful.Request, response *restful.Response) {
+	if !strings.HasSuffix(request.Request.URL.Path, "/") {
+		// the index links to the profiles relatively. Keep the Location
+		// relative as well, the Admin may be mounted below a prefix.
+		response.Header().Set("Location", "pprof/")
+		response.WriteHeader(http.StatusMovedPermanently)
+		return
+	}
+
+	pprof.Index(response, request.Request)
+}
+
+func pprofProfile(request *restful.Request, response *restful.Response) {
+	pprof.Handler(request.PathParameter("profile")).ServeHTTP(response, request.Request)
+}
+
+func (a *Admin) stats(request *restful.Request, response *restful.Response) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	response.WriteEntity(RuntimeStats{
+		GoVersion:        runtime.Version(),
+		NumCPU:           runtime.NumCPU(),
+		Goroutines:       runtime.NumGoroutine(),
+		InFlightRequests: a.server.PendingRequests(),
+		ShuttingDown:     a.server.ShuttingDown(),
+		Heap: HeapStats{
+			Alloc:      mem.Alloc,
+			TotalAlloc: mem.TotalAlloc,
+			Sys:        mem.Sys,
+			InUse:      mem.HeapInuse,
+			Objects:    mem.HeapObjects,
+			NumGC:      mem.NumGC,
+			PauseTotal: time.Duration(mem.PauseTotalNs).String(),
+		},
+	})
+}
+
+func (a *Admin) config(request *restful.Request, response *restful.Response) {
+	response.Header().Set(restful.HEADER_ContentType, "text/plain; charset=utf-8")
+	response.Write([]byte(a.server.Config.String()))
+}
+
+func (a *Admin) logLevel(request *restful.Request, response *restful.Response) {
+	logger, ok := a.server.Config.logger().(LevelLogger)
+	if !ok || logger.Level() == "" {
+		ErrorResponseHandler(request, response, ErrLevelUnsupported, NewErrorResponse(
+			http.StatusNotImplemented,
+			ErrLevelUnsupported,
+			"GET"))
+		return
+	}
+
+	response.WriteEntity(LogLevel{Level: logger.Level()})
+}
+
+func (a *Admin) setLogLevel(request *restful.Request, response *restful.Response) {
+	logger, ok := a.server.Config.logger().(LevelLogger)
+	if !ok {
+		ErrorResponseHandler(request, response, ErrLevelUnsupported, NewErrorResponse(
+			http.StatusNotImplemented,
+			ErrLevelUnsupported,
+			"PUT"))
+		return
+	}
+
+	var level LogLevel
+	if err := request.ReadEntity(&level); err != nil {
+		bodyReadError(request, response, err, "PUT")
+		return
+	}
+	if err := logger.SetLevel(level.Level); err != nil {
+		status := http.StatusBadRequest
+		if err == ErrLevelUnsupported {
+			status = http.StatusNotImplemented
+		}
+		ErrorResponseHandler(request, response, err, NewErrorResponse(
+			status,
+			err,
+			"PUT"))
+		return
+	}
+
+	a.server.Config.logger().WithFields(Fields{"Level": logger.Level()}).Info("Changed log level")
+	response.WriteEntity(LogLevel{Level: logger.Level()})
+}
@@ -0,0 +1,54 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminLogsToConfiguredLogger(t *testing.T) {
+	logger := newRecordingLogger()
+	a := NewAdmin(newTestServer(APIConfig{Logger: logger}), &testContext{})
+
+	tests := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"unauthenticated", "", http.StatusUnauthorized},
+		{"authenticated", "valid", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			a.ServeHTTP(rec, req)
+
+			if rec.Code != tt.code {
+				t.Errorf("got status %d, want %d", rec.Code, tt.code)
+			}
+			if rec.Header().Get(HeaderRequestID) == "" {
+				t.Errorf("response is missing the %s header", HeaderRequestID)
+			}
+		})
+	}
+
+	fields, ok := logger.entry(errAdminAuthRequired.Error())
+	if !ok {
+		t.Fatal("admin error wasn't logged to the configured Logger")
+	}
+	if id, _ := fields["RequestID"].(string); id == "" {
+		t.Errorf("admin error was logged without a RequestID: %v", fields)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+)
+
+const (
+	// AccessTokenParam is the query parameter carrying the access token
+	AccessTokenParam = "accesstoken"
+
+	authConfigAttribute = "authConfig"
+	bearerScheme        = "bearer "
+	redactedToken       = "REDACTED"
+)
+
+var defaultTokenHeaders = []string{"Authorization"}
+
+// AuthConfig contains the parameters for extracting access tokens from
+// requests
+type AuthConfig struct {
+	// Headers are searched for an access token, in order. The Authorization
+	// header expects the Bearer scheme, all other headers contain just the
+	// token. Defaults to "Authorization".
+	Headers []string
+	// DisableQueryParam ignores access tokens passed in the accesstoken
+	// query parameter, which may leak into logs and proxies
+	DisableQueryParam bool
+}
+
+func (c AuthConfig) headers() []string {
+	if len(c.Headers) == 0 {
+		return defaultTokenHeaders
+	}
+	return c.Headers
+}
+
+// AccessToken returns the access token of request, or an empty string if
+// it doesn't carry one
+func (c AuthConfig) AccessToken(request *http.Request) string {
+	for _, h := range c.headers() {
+		v := strings.TrimSpace(request.Header.Get(h))
+		if v == "" {
+			continue
+		}
+
+		if http.CanonicalHeaderKey(h) == "Authorization" {
+			if len(v) <= len(bearerScheme) || !strings.EqualFold(v[:len(bearerScheme)], bearerScheme) {
+				continue
+			}
+			v = strings.TrimSpace(v[len(bearerScheme):])
+		}
+		return v
+	}
+
+	if !c.DisableQueryParam {
+		return request.URL.Query().Get(AccessTokenParam)
+	}
+	return ""
+}
+
+// AccessToken returns the access token of a request handled by a Resource,
+// as permitted by the Resource's AuthConfig. APIContext implementations can
+// call it from Authentication.
+func AccessToken(request *restful.Request) string {
+	config, _ := request.Attribute(authConfigAttribute).(AuthConfig)
+	return config.AccessToken(request.Request)
+}
+
+// authParams documents how the access token can be passed to route
+func (r Resource) authParams(route *restful.RouteBuilder) {
+	config := r.Config.Auth
+	headers := config.headers()
+
+	// any of the parameters can carry the token
+	required := len(headers) == 1 && config.DisableQueryParam
+	for _, h := range headers {
+		desc := "access token required for auth"
+		if http.CanonicalHeaderKey(h) == "Authorization" {
+			desc = "Bearer access token required for auth"
+		}
+		route.Param(restful.HeaderParameter(h, desc).
+			DataType("string").
+			Required(required).
+			AllowMultiple(false))
+	}
+
+	if !config.DisableQueryParam {
+		route.Param(restful.QueryParameter(AccessTokenParam, "accesstoken required for auth").
+			DataType("string").
+			Required(false).
+			AllowMultiple(false))
+	}
+}
+
+// redactAccessToken replaces the access token in a URL's query, so it can be
+// logged
+func redactAccessToken(uri string) string {
+	if !strings.Contains(uri, AccessTokenParam+"=") {
+		return uri
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	q := u.Query()
+	if _, ok := q[AccessTokenParam]; ok {
+		q.Set(AccessTokenParam, redactedToken)
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
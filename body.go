@@ -0,0 +1,179 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+)
+
+var (
+	// ErrBodyTooLarge is returned when reading a request body that exceeds
+	// the configured maximum size
+	ErrBodyTooLarge = errors.New("Request body too large")
+
+	// ErrUnsupportedEncoding is returned for request bodies with a
+	// Content-Encoding other than gzip or deflate
+	ErrUnsupportedEncoding = errors.New("Unsupported Content-Encoding")
+)
+
+// MaxBodySizeSupported can be implemented by Resources to override the
+// maximum request body size configured in APIConfig. Zero keeps the
+// configured limit, a negative size accepts bodies of any size, e.g. for
+// uploads.
+type MaxBodySizeSupported interface {
+	MaxBodySize() int64
+}
+
+// maxBodySize returns the maximum accepted request body size in bytes
+func (r Resource) maxBodySize() int64 {
+	if res, ok := r.Parent.(MaxBodySizeSupported); ok {
+		switch size := res.MaxBodySize(); {
+		case size > 0:
+			return size
+		case size < 0:
+			return 0
+		}
+	}
+	return r.Config.MaxBodySize
+}
+
+// bodyFilter decompresses request bodies and rejects them if they exceed
+// limit bytes after decompression. A limit of zero disables the size check.
+func bodyFilter(limit int64) restful.FilterFunction {
+	return func(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+		method := request.Request.Method
+		if limit > 0 && request.Request.ContentLength > limit {
+			ErrorResponseHandler(request, response, ErrBodyTooLarge, NewErrorResponse(
+				http.StatusRequestEntityTooLarge,
+				"Request body exceeds the limit of "+strconv.FormatInt(limit, 10)+" bytes",
+				method+" Data Validation"))
+			return
+		}
+
+		if err := decodeBody(request.Request); err != nil {
+			code := http.StatusBadRequest
+			if err == ErrUnsupportedEncoding {
+				code = http.StatusUnsupportedMediaType
+				response.AddHeader("Accept-Encoding", "gzip, deflate")
+			}
+			ErrorResponseHandler(request, response, err, NewErrorResponse(
+				code,
+				err,
+				method+" Data Validation"))
+			return
+		}
+
+		// Content-Length may be missing, lie or refer to the compressed
+		// body, so enforce the limit while reading
+		if limit > 0 && request.Request.Body != nil {
+			request.Request.Body = &limitedBody{
+				ReadCloser: request.Request.Body,
+				remaining:  limit,
+			}
+		}
+
+		chain.ProcessFilter(request, response)
+	}
+}
+
+// limitedBody fails with ErrBodyTooLarge once more than remaining bytes are read
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > b.remaining+1 {
+		// read one byte more than allowed to detect oversized bodies
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = -1
+		return n, ErrBodyTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// bodyReadError responds to a failed ReadEntity
+func bodyReadError(request *restful.Request, response *restful.Response, err error, method string) {
+	if err == ErrBodyTooLarge {
+		ErrorResponseHandler(request, response, err, NewErrorResponse(
+			http.StatusRequestEntityTooLarge,
+			err,
+			method+" Data Validation"))
+		return
+	}
+
+	ErrorResponseHandler(request, response, err, NewErrorResponse(
+		http.StatusBadRequest,
+		"Can't parse request data",
+		method+" Data Validation"))
+}
+
+// decodeBody replaces the body of a request having a Content-Encoding with
+// its decompressed content
+func decodeBody(request *http.Request) error {
+	header := request.Header.Get(restful.HEADER_ContentEncoding)
+	if header == "" || request.Body == nil {
+		return nil
+	}
+
+	encodings := strings.Split(header, ",")
+	body := request.Body
+	// encodings are listed in the order they were applied
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var r io.Reader
+		var err error
+
+		switch strings.ToLower(strings.TrimSpace(encodings[i])) {
+		case "identity", "":
+			continue
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(body)
+		case "deflate":
+			r, err = zlib.NewReader(body)
+		default:
+			return ErrUnsupportedEncoding
+		}
+		if err != nil {
+			return errors.New("Can't decode request body: " + err.Error())
+		}
+
+		body = decodedBody{
+			Reader: r,
+			Closer: request.Body,
+		}
+	}
+
+	request.Body = body
+	request.ContentLength = -1
+	request.Header.Del(restful.HEADER_ContentEncoding)
+	request.Header.Del("Content-Length")
+	return nil
+}
+
+// decodedBody reads the decompressed content and closes the original body
+type decodedBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,151 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+)
+
+// bodyContainer serves a POST route echoing the size of the request body
+// read through bodyFilter
+func bodyContainer(limit int64) *restful.Container {
+	ws := new(restful.WebService)
+	ws.Produces(restful.MIME_JSON)
+	ws.Route(ws.POST("/").Filter(bodyFilter(limit)).To(func(request *restful.Request, response *restful.Response) {
+		b, err := ioutil.ReadAll(request.Request.Body)
+		if err != nil {
+			bodyReadError(request, response, err, "POST")
+			return
+		}
+		response.Write([]byte(strconv.Itoa(len(b))))
+	}))
+
+	c := restful.NewContainer()
+	c.Add(ws)
+	return c
+}
+
+func gzipped(b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func deflated(b []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestBodyFilter(t *testing.T) {
+	small := []byte(strings.Repeat("a", 100))
+	large := []byte(strings.Repeat("a", 1000))
+
+	tests := []struct {
+		name     string
+		limit    int64
+		body     []byte
+		encoding string
+		chunked  bool
+		code     int
+		size     string
+	}{
+		{"within limit", 500, small, "", false, http.StatusOK, "100"},
+		{"exactly the limit", 100, small, "", false, http.StatusOK, "100"},
+		{"Content-Length exceeds limit", 500, large, "", false, http.StatusRequestEntityTooLarge, ""},
+		{"chunked body exceeds limit", 500, large, "", true, http.StatusRequestEntityTooLarge, ""},
+		{"no limit", 0, large, "", false, http.StatusOK, "1000"},
+		{"gzip within limit", 500, gzipped(small), "gzip", false, http.StatusOK, "100"},
+		{"x-gzip", 500, gzipped(small), "x-gzip", false, http.StatusOK, "100"},
+		{"deflate within limit", 500, deflated(small), "deflate", false, http.StatusOK, "100"},
+		{"gzip exceeds limit once decompressed", 500, gzipped(large), "gzip", false, http.StatusRequestEntityTooLarge, ""},
+		{"stacked encodings", 500, gzipped(deflated(small)), "deflate, gzip", false, http.StatusOK, "100"},
+		{"identity", 500, small, "identity", false, http.StatusOK, "100"},
+		{"unsupported encoding", 500, small, "br", false, http.StatusUnsupportedMediaType, ""},
+		{"corrupt gzip", 500, small, "gzip", false, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader = bytes.NewReader(tt.body)
+			if tt.chunked {
+				// hide the length from httptest.NewRequest
+				body = ioutil.NopCloser(body)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/", body)
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			rec := httptest.NewRecorder()
+			bodyContainer(tt.limit).ServeHTTP(rec, req)
+
+			if rec.Code != tt.code {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.code, rec.Body.String())
+			}
+			if tt.size != "" && rec.Body.String() != tt.size {
+				t.Errorf("handler read %s bytes, want %s", rec.Body.String(), tt.size)
+			}
+			if tt.code == http.StatusUnsupportedMediaType && rec.Header().Get("Accept-Encoding") == "" {
+				t.Error("missing Accept-Encoding header")
+			}
+		})
+	}
+}
+
+type bodySizeResource struct {
+	size int64
+}
+
+func (r bodySizeResource) MaxBodySize() int64 {
+	return r.size
+}
+
+func TestMaxBodySize(t *testing.T) {
+	tests := []struct {
+		configured int64
+		parent     interface{}
+		want       int64
+	}{
+		{1000, nil, 1000},
+		{0, nil, 0},
+		{1000, bodySizeResource{500}, 500},
+		{1000, bodySizeResource{5000}, 5000},
+		{1000, bodySizeResource{0}, 1000},
+		{1000, bodySizeResource{-1}, 0},
+		{0, bodySizeResource{500}, 500},
+	}
+
+	for _, tt := range tests {
+		r := Resource{
+			Config: APIConfig{MaxBodySize: tt.configured},
+			Parent: tt.parent,
+		}
+		if got := r.maxBodySize(); got != tt.want {
+			t.Errorf("maxBodySize with %d configured and %v = %d, want %d", tt.configured, tt.parent, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the IP address of the client that sent request. The
+// X-Forwarded-For header is only honored for requests relayed by one of the
+// trustedProxies, which may contain IP addresses or CIDR ranges.
+func ClientIP(request *http.Request, trustedProxies []string) string {
+	ip := request.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if len(trustedProxies) == 0 || !ipTrusted(ip, trustedProxies) {
+		return ip
+	}
+
+	// Walk the chain of proxies backwards, the first untrusted address is
+	// the client's
+	hops := strings.Split(strings.Join(request.Header["X-Forwarded-For"], ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !ipTrusted(hop, trustedProxies) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func ipTrusted(ip string, trustedProxies []string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for _, p := range trustedProxies {
+		if strings.Contains(p, "/") {
+			if _, network, err := net.ParseCIDR(p); err == nil && network.Contains(addr) {
+				return true
+			}
+		} else if trusted := net.ParseIP(p); trusted != nil && trusted.Equal(addr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,255 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+)
+
+const defaultCompressionMinSize = 1024
+
+// Content types that don't benefit from another round of compression
+var compressedContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+}
+
+// CompressionConfig contains the parameters for compressing responses
+type CompressionConfig struct {
+	// Enabled compresses responses for clients accepting gzip or deflate
+	Enabled bool
+	// MinSize is the smallest body in bytes worth compressing, defaults to 1024
+	MinSize int
+	// Level is the gzip/deflate compression level, zero uses the default level
+	Level int
+}
+
+// negotiateEncoding picks the preferred of the supported encodings from an
+// Accept-Encoding header. Codings with a q-value of 0 are refused by the
+// client, explicitly listed codings take precedence over "*".
+func negotiateEncoding(acceptEncoding string) string {
+	qs := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		qs[coding] = q
+	}
+
+	var best string
+	var bestQ float64
+	// gzip wins ties
+	for _, coding := range []string{"gzip", "deflate"} {
+		q, ok := qs[coding]
+		if !ok {
+			q, ok = qs["*"]
+		}
+		if ok && q > 0 && q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+
+	return best
+}
+
+func (s *Server) compressionFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	response.Header().Add("Vary", restful.HEADER_AcceptEncoding)
+
+	encoding := negotiateEncoding(request.Request.Header.Get(restful.HEADER_AcceptEncoding))
+	if encoding == "" || request.Request.Method == http.MethodHead {
+		chain.ProcessFilter(request, response)
+		return
+	}
+
+	cw := &compressWriter{
+		ResponseWriter: response.ResponseWriter,
+		encoding:       encoding,
+		level:          s.Config.Compression.Level,
+		minSize:        s.Config.Compression.MinSize,
+		code:           http.StatusOK,
+	}
+	if cw.level == 0 {
+		cw.level = flate.DefaultCompression
+	}
+	if cw.minSize <= 0 {
+		cw.minSize = defaultCompressionMinSize
+	}
+
+	response.ResponseWriter = cw
+	defer func() {
+		cw.Close()
+		response.ResponseWriter = cw.ResponseWriter
+	}()
+
+	chain.ProcessFilter(request, response)
+}
+
+// compressWriter buffers the beginning of a response to decide whether it is
+// worth compressing
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	level    int
+	minSize  int
+
+	code        int
+	wroteHeader bool
+	buf         []byte
+	decided     bool
+	compressor  io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.code = code
+
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		// these responses never have a body
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.minSize {
+			return len(p), nil
+		}
+
+		if err := cw.decide(cw.compressible()); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.compressor != nil {
+		return cw.compressor.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush sends the buffered data, compressing it if possible
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(cw.compressible())
+	}
+	if f, ok := cw.compressor.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes out the remaining response
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		// the body is too small to be worth compressing
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+	if cw.compressor != nil {
+		return cw.compressor.Close()
+	}
+	return nil
+}
+
+// compressible returns whether the response's content should be compressed
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	if h.Get(restful.HEADER_ContentEncoding) != "" {
+		return false
+	}
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil && n < cw.minSize {
+		// flushed early, but too small to be worth compressing
+		return false
+	}
+
+	contentType := strings.ToLower(h.Get(restful.HEADER_ContentType))
+	if strings.HasPrefix(contentType, "image/svg") {
+		return true
+	}
+	for _, t := range compressedContentTypes {
+		if strings.HasPrefix(contentType, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// decide writes the headers and buffered data, either compressed or as-is
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+
+	if compress {
+		var compressor io.WriteCloser
+		var err error
+		if cw.encoding == "gzip" {
+			compressor, err = gzip.NewWriterLevel(cw.ResponseWriter, cw.level)
+		} else {
+			// HTTP's deflate is the zlib format
+			compressor, err = zlib.NewWriterLevel(cw.ResponseWriter, cw.level)
+		}
+
+		// an invalid compression level leaves the response uncompressed
+		if err == nil {
+			cw.compressor = compressor
+			cw.Header().Set(restful.HEADER_ContentEncoding, cw.encoding)
+			cw.Header().Del("Content-Length")
+		}
+	}
+
+	if cw.wroteHeader || len(cw.buf) > 0 {
+		cw.ResponseWriter.WriteHeader(cw.code)
+	}
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	buf := cw.buf
+	cw.buf = nil
+	if cw.compressor != nil {
+		_, err := cw.compressor.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
@@ -0,0 +1,46 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import "testing"
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"GZIP", "gzip"},
+		{"gzip, deflate", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip;q=0.5, deflate;q=0.5", "gzip"},
+		{"br, deflate;q=0.1", "deflate"},
+		{"*", "gzip"},
+		{"*;q=0.5, deflate", "deflate"},
+
+		// refused codings
+		{"gzip;q=0", ""},
+		{"identity, gzip;q=0", ""},
+		{"*;q=0", ""},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"gzip;q=0, deflate", "deflate"},
+		{"gzip;q=0, *", "deflate"},
+		{"*, gzip;q=0, deflate;q=0", ""},
+		{"gzip; q=0.000", ""},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.acceptEncoding); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.acceptEncoding, got, tt.want)
+		}
+	}
+}
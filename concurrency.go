@@ -0,0 +1,107 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+const defaultRetryAfter = time.Second
+
+var (
+	// ErrOverloaded is reported to clients when a request was shed because
+	// too many requests are already being processed
+	ErrOverloaded = errors.New("Server is overloaded")
+
+	errShuttingDown = errors.New("Server is shutting down")
+)
+
+// ConcurrencyConfig contains the parameters for limiting the number of
+// concurrently processed requests
+type ConcurrencyConfig struct {
+	// MaxRequests limits the requests in-flight per Server, zero disables it
+	MaxRequests int
+	// QueueTimeout is how long a request may wait for a free slot before it
+	// gets rejected. Zero rejects it immediately.
+	QueueTimeout time.Duration
+	// RetryAfter is advertised to rejected clients, defaults to 1s
+	RetryAfter time.Duration
+}
+
+// MaxConcurrentRequestsSupported can be implemented by Resources to limit
+// the number of their requests being processed concurrently
+type MaxConcurrentRequestsSupported interface {
+	MaxConcurrentRequests() int
+}
+
+// limiter is a semaphore limiting the requests in-flight for a Resource
+type limiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+	retryAfter   time.Duration
+}
+
+func (r Resource) newLimiter() *limiter {
+	res, ok := r.Parent.(MaxConcurrentRequestsSupported)
+	if !ok || res.MaxConcurrentRequests() <= 0 {
+		return nil
+	}
+
+	return &limiter{
+		slots:        make(chan struct{}, res.MaxConcurrentRequests()),
+		queueTimeout: r.Config.Concurrency.QueueTimeout,
+		retryAfter:   r.Config.Concurrency.RetryAfter,
+	}
+}
+
+// filter waits for a free slot or sheds the request
+func (l *limiter) filter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		if l.queueTimeout <= 0 {
+			shed(request, response, l.retryAfter, ErrOverloaded)
+			return
+		}
+
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+
+		select {
+		case l.slots <- struct{}{}:
+		case <-timer.C:
+			shed(request, response, l.retryAfter, ErrOverloaded)
+			return
+		case <-request.Request.Context().Done():
+			shed(request, response, l.retryAfter, request.Request.Context().Err())
+			return
+		}
+	}
+	defer func() {
+		<-l.slots
+	}()
+
+	chain.ProcessFilter(request, response)
+}
+
+// shed rejects a request with a 503 and asks the client to retry later
+func shed(request *restful.Request, response *restful.Response, retryAfter time.Duration, err error) {
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+
+	response.Header().Set("Retry-After", formatSeconds(retryAfter))
+	filterErrorResponse(request, response, err, NewErrorResponse(
+		http.StatusServiceUnavailable,
+		ErrOverloaded,
+		request.Request.Method))
+}
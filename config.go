@@ -7,8 +7,136 @@
 
 package smolder
 
+import (
+	"compress/gzip"
+	"net"
+	"os"
+	"sort"
+	"time"
+)
+
 // APIConfig contains all parameters required to set up a new smolder API
 type APIConfig struct {
 	BaseURL    string
 	PathPrefix string
+
+	// Logger receives all log entries, defaults to logrus' standard logger
+	Logger    Logger `json:"-"`
+	AccessLog AccessLogConfig
+	Metrics   MetricsConfig
+	Tracing   TracingConfig
+	TLS       TLSConfig
+
+	Compression CompressionConfig
+
+	// Debug exposes panic messages and stack traces in error responses
+	Debug bool
+	// Timeout is the default deadline for handling a request, zero disables it
+	Timeout time.Duration
+	// MaxBodySize limits the size of request bodies in bytes, zero disables it
+	MaxBodySize int64
+	// TrustedProxies contains the IPs or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For headers are honored
+	TrustedProxies []string
+
+	RateLimit   RateLimitConfig
+	Concurrency ConcurrencyConfig
+
+	Auth            AuthConfig
+	CORS            CORSConfig
+	SecurityHeaders SecurityHeadersConfig
+	Health          HealthConfig
+	Maintenance     MaintenanceConfig
+	Routes          RoutesConfig
+}
+
+// HealthConfig contains the parameters for the built-in liveness and
+// readiness endpoints
+type HealthConfig struct {
+	// Enabled registers the health endpoints with the Container
+	Enabled bool
+	// LivenessPath defaults to "healthz"
+	LivenessPath string
+	// ReadinessPath defaults to "readyz"
+	ReadinessPath string
+	// Timeout is used for checks that don't specify their own, defaults to 5s
+	Timeout time.Duration
+
+	Checks []HealthCheck `json:"-"`
+}
+
+// Validate checks the configuration for invalid or contradicting options
+func (config APIConfig) Validate() error {
+	var problems []string
+	check := func(ok bool, option, problem string) {
+		if !ok {
+			problems = append(problems, option+": "+problem)
+		}
+	}
+
+	check(config.Timeout >= 0, "Timeout", "must not be negative")
+	check(config.MaxBodySize >= 0, "MaxBodySize", "must not be negative")
+	for _, p := range config.TrustedProxies {
+		_, _, err := net.ParseCIDR(p)
+		check(err == nil || net.ParseIP(p) != nil, "TrustedProxies", "invalid IP or CIDR range "+p)
+	}
+
+	switch config.AccessLog.Format {
+	case "", AccessLogStructured, AccessLogCombined, AccessLogJSON:
+	default:
+		check(false, "AccessLog.Format", "unknown format "+config.AccessLog.Format)
+	}
+	for _, f := range config.AccessLog.Fields {
+		check(f == AccessLogURL || containsString(defaultAccessLogFields, f), "AccessLog.Fields", "unknown field "+f)
+	}
+	check(config.AccessLog.SlowThreshold >= 0, "AccessLog.SlowThreshold", "must not be negative")
+
+	check(sort.Float64sAreSorted(config.Metrics.DurationBuckets), "Metrics.DurationBuckets", "must be in ascending order")
+	check(sort.Float64sAreSorted(config.Metrics.SizeBuckets), "Metrics.SizeBuckets", "must be in ascending order")
+
+	tls := config.TLS
+	check((tls.CertFile == "") == (tls.KeyFile == ""), "TLS", "CertFile and KeyFile must be set together")
+	check(!tls.RequireClientCert || tls.ClientCAFile != "", "TLS.RequireClientCert", "requires a ClientCAFile")
+	check(tls.ClientCAFile == "" || tls.enabled(), "TLS.ClientCAFile", "requires a CertFile and KeyFile")
+	for option, f := range map[string]string{"TLS.CertFile": tls.CertFile, "TLS.KeyFile": tls.KeyFile, "TLS.ClientCAFile": tls.ClientCAFile} {
+		if f != "" {
+			_, err := os.Stat(f)
+			check(err == nil, option, "can't access "+f)
+		}
+	}
+
+	check(config.Compression.Level >= gzip.HuffmanOnly && config.Compression.Level <= gzip.BestCompression,
+		"Compression.Level", "must be between -2 and 9")
+	check(config.Compression.MinSize >= 0, "Compression.MinSize", "must not be negative")
+
+	check(config.RateLimit.Default.Limit >= 0, "RateLimit.Default.Limit", "must not be negative")
+	check(config.RateLimit.Default.Period >= 0, "RateLimit.Default.Period", "must not be negative")
+	check(config.RateLimit.Default.Limit == 0 || config.RateLimit.Default.Period > 0, "RateLimit.Default.Period", "is required with a Limit")
+
+	check(config.Concurrency.MaxRequests >= 0, "Concurrency.MaxRequests", "must not be negative")
+	check(config.Concurrency.QueueTimeout >= 0, "Concurrency.QueueTimeout", "must not be negative")
+	check(config.Concurrency.RetryAfter >= 0, "Concurrency.RetryAfter", "must not be negative")
+
+	check(!config.CORS.AllowCredentials || !config.CORS.allowsAnyOrigin(), "CORS.AllowCredentials", "requires explicit AllowedOrigins")
+	check(config.CORS.MaxAge >= 0, "CORS.MaxAge", "must not be negative")
+
+	check(config.Health.Timeout >= 0, "Health.Timeout", "must not be negative")
+
+	check(!config.Maintenance.Endpoint || config.Maintenance.Context != nil, "Maintenance.Context", "is required by the admin endpoint")
+	check(!config.Routes.Endpoint || config.Routes.Context != nil, "Routes.Context", "is required by the admin endpoint")
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return &ConfigError{Source: "APIConfig", Problems: problems}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,397 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// EnvPrefix is the prefix of all environment variables overriding the
+// configuration, e.g. SMOLDER_TIMEOUT=30s or SMOLDER_CORS_ALLOWED_ORIGINS.
+// Nested settings join their names with an underscore, lists are
+// comma-separated.
+const EnvPrefix = "SMOLDER_"
+
+const maskedSecret = "******"
+
+// secretNames are the parts of option names that mark them as secret
+var secretNames = []string{"password", "secret", "token", "credential"}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// LoadConfig reads an APIConfig from the JSON or YAML file at path, applies
+// the overrides found in environment variables prefixed with EnvPrefix and
+// validates the result. An empty path only reads the environment.
+func LoadConfig(path string) (APIConfig, error) {
+	var config APIConfig
+	if path != "" {
+		if err := config.LoadFile(path); err != nil {
+			return config, err
+		}
+	}
+	if err := config.LoadEnv(EnvPrefix); err != nil {
+		return config, err
+	}
+
+	return config, config.Validate()
+}
+
+// LoadFile sets all options found in the JSON or YAML file at path. The
+// format is determined by the file's extension. Option names are matched
+// case-insensitively and may contain underscores or dashes, e.g.
+// "MaxBodySize", "maxBodySize" and "max_body_size" are equivalent.
+// Durations are given as strings like "1m30s".
+func (config *APIConfig) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	settings := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&settings)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &settings)
+	default:
+		return errors.New("Unsupported config file format: " + path)
+	}
+	if err != nil {
+		return errors.New("Can't parse " + path + ": " + err.Error())
+	}
+
+	var problems []string
+	applySettings(reflect.ValueOf(config).Elem(), settings, "", &problems)
+	if len(problems) > 0 {
+		return &ConfigError{Source: path, Problems: problems}
+	}
+	return nil
+}
+
+// LoadEnv sets all options found in environment variables starting with
+// prefix. The variable names are the upper-case option names, with words
+// separated by underscores.
+func (config *APIConfig) LoadEnv(prefix string) error {
+	var problems []string
+	walkConfig(reflect.ValueOf(config).Elem(), nil, false, func(path []string, v reflect.Value, secret bool) {
+		name := prefix + envName(path)
+		if s, ok := os.LookupEnv(name); ok {
+			if err := setValue(v, s); err != nil {
+				problems = append(problems, name+": "+err.Error())
+			}
+		}
+	})
+
+	if len(problems) > 0 {
+		return &ConfigError{Source: "environment", Problems: problems}
+	}
+	return nil
+}
+
+// String prints the effective configuration, one option per line. Options
+// tagged with `smolder:"secret"`, options whose name suggests a secret, e.g.
+// a Password or Token, and the passwords of URLs are masked.
+func (config APIConfig) String() string {
+	var b strings.Builder
+	walkConfig(reflect.ValueOf(config), nil, false, func(path []string, v reflect.Value, secret bool) {
+		value := formatValue(v)
+		if secret && value != "" {
+			value = maskedSecret
+		} else {
+			value = maskURLPassword(value)
+		}
+		b.WriteString(strings.Join(path, ".") + ": " + value + "\n")
+	})
+
+	return b.String()
+}
+
+// ConfigError lists all problems found in a configuration
+type ConfigError struct {
+	Source   string
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "Invalid configuration in " + e.Source + ": " + strings.Join(e.Problems, "; ")
+}
+
+// walkConfig calls fn for every configurable option of the struct v
+func walkConfig(v reflect.Value, path []string, secret bool, fn func(path []string, v reflect.Value, secret bool)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+			continue
+		}
+
+		p := append(append([]string(nil), path...), f.Name)
+		s := secret || f.Tag.Get("smolder") == "secret" || secretName(f.Name, f.Type)
+		if f.Type.Kind() == reflect.Struct && f.Type != durationType {
+			walkConfig(v.Field(i), p, s, fn)
+			continue
+		}
+		fn(p, v.Field(i), s)
+	}
+}
+
+// secretName tells whether an option called name likely contains a secret.
+// Only options of type t that can hold one qualify, so flags like
+// AllowCredentials stay readable.
+func secretName(name string, t reflect.Type) bool {
+	if !secretType(t) {
+		return false
+	}
+
+	name = strings.ToLower(name)
+	for _, s := range secretNames {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretType tells whether values of type t can hold a secret
+func secretType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Struct, reflect.Map:
+		return t != durationType
+	case reflect.Array, reflect.Slice, reflect.Ptr:
+		return secretType(t.Elem())
+	}
+	return false
+}
+
+// maskURLPassword masks the password of value if it's a URL
+func maskURLPassword(value string) string {
+	if !strings.Contains(value, "@") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+
+	// url.URL escapes the mask, so drop the password and add the mask after
+	u.User = url.User(u.User.Username())
+	user := u.User.String()
+	return strings.Replace(u.String(), user+"@", user+":"+maskedSecret+"@", 1)
+}
+
+// applySettings sets the fields of the struct v from a decoded config file
+func applySettings(v reflect.Value, settings map[string]interface{}, path string, problems *[]string) {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		raw := settings[key]
+		f, ok := fieldByName(v, key)
+		if !ok {
+			*problems = append(*problems, "unknown option "+path+key)
+			continue
+		}
+
+		name := path + v.Type().Field(f).Name
+		field := v.Field(f)
+		if field.Kind() == reflect.Struct && field.Type() != durationType {
+			m, ok := stringMap(raw)
+			if !ok {
+				*problems = append(*problems, name+": expected a map of options")
+				continue
+			}
+			applySettings(field, m, name+".", problems)
+			continue
+		}
+
+		if err := setValue(field, raw); err != nil {
+			*problems = append(*problems, name+": "+err.Error())
+		}
+	}
+}
+
+// fieldByName returns the index of the configurable field of the struct v
+// matching name
+func fieldByName(v reflect.Value, name string) (int, bool) {
+	name = normalizeName(name)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+			continue
+		}
+		if normalizeName(f.Name) == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func normalizeName(name string) string {
+	name = strings.Replace(name, "_", "", -1)
+	name = strings.Replace(name, "-", "", -1)
+	return strings.ToLower(name)
+}
+
+// stringMap converts the maps decoded from JSON and YAML files
+func stringMap(raw interface{}) (map[string]interface{}, bool) {
+	switch m := raw.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		r := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			r[fmt.Sprint(k)] = v
+		}
+		return r, true
+	}
+	return nil, false
+}
+
+// setValue parses raw into v. raw is a decoded scalar or list, or a string
+// from the environment, where lists are comma-separated.
+func setValue(v reflect.Value, raw interface{}) error {
+	if v.Kind() == reflect.Slice {
+		var items []interface{}
+		switch r := raw.(type) {
+		case []interface{}:
+			items = r
+		case string:
+			for _, s := range strings.Split(r, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					items = append(items, s)
+				}
+			}
+		default:
+			return errors.New("expected a list")
+		}
+
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+
+	var s string
+	switch r := raw.(type) {
+	case nil:
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	case []interface{}, map[string]interface{}, map[interface{}]interface{}:
+		return errors.New("expected a single value")
+	default:
+		s = strings.TrimSpace(fmt.Sprint(r))
+	}
+
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, expected a value like \"30s\"", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(f)
+	default:
+		return errors.New("unsupported option type " + v.Type().String())
+	}
+	return nil
+}
+
+// formatValue prints an option's value
+func formatValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Slice {
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatValue(v.Index(i))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+// envName converts an option's path to the environment variable's name,
+// e.g. CORS.AllowedOrigins becomes CORS_ALLOWED_ORIGINS
+func envName(path []string) string {
+	words := make([]string, 0, len(path))
+	for _, p := range path {
+		words = append(words, splitWords(p)...)
+	}
+	return strings.ToUpper(strings.Join(words, "_"))
+}
+
+// splitWords splits a CamelCase name into words, keeping acronyms together,
+// e.g. HSTSMaxAge becomes HSTS, Max, Age
+func splitWords(name string) []string {
+	var words []string
+	runes := []rune(name)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		if !unicode.IsUpper(runes[i]) {
+			continue
+		}
+		if !unicode.IsUpper(runes[i-1]) ||
+			(i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(runes[start:]))
+}
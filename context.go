@@ -7,7 +7,11 @@
 
 package smolder
 
-import "github.com/emicklei/go-restful"
+import (
+	"context"
+
+	"github.com/emicklei/go-restful"
+)
 
 // APIContextFactory allows you to retrieve a new APIContext
 type APIContextFactory interface {
@@ -19,3 +23,39 @@ type APIContext interface {
 	Authentication(request *restful.Request) (interface{}, error)
 	SetAuth(auth interface{})
 }
+
+// RequestIDSetter can optionally be implemented by an APIContext to learn the
+// ID of the request it was created for
+type RequestIDSetter interface {
+	SetRequestID(id string)
+}
+
+// RequestContextSetter can optionally be implemented by an APIContext to
+// receive the request's context.Context, which carries its deadline and
+// should be passed on to downstream calls
+type RequestContextSetter interface {
+	SetRequestContext(ctx context.Context)
+}
+
+// SpanSetter can optionally be implemented by an APIContext to receive the
+// Span tracing its request, e.g. to start child spans
+type SpanSetter interface {
+	SetSpan(span *Span)
+}
+
+// Identifier can optionally be implemented by the value returned from
+// APIContext.Authentication to identify the authenticated user, e.g. for
+// rate limiting and access logs. Other users remain anonymous there, their
+// values may contain secrets that must not be logged.
+type Identifier interface {
+	Identity() string
+}
+
+// identity returns a string identifying the authenticated user auth, or an
+// empty string for anonymous users
+func identity(auth interface{}) string {
+	if a, ok := auth.(Identifier); ok {
+		return a.Identity()
+	}
+	return ""
+}
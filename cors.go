@@ -0,0 +1,220 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+var (
+	defaultCORSHeaders = []string{"authorization", "content-type"}
+)
+
+// CORSConfig contains the Cross-Origin Resource Sharing policy of an API.
+// The zero value allows requests from any origin without credentials.
+type CORSConfig struct {
+	// AllowedOrigins contains exact origins ("https://example.com"), wildcard
+	// subdomains ("https://*.example.com") or "*". Defaults to "*".
+	AllowedOrigins []string
+	// AllowedHeaders may be requested by a preflight, "*" allows any header.
+	// Defaults to "authorization, content-type".
+	AllowedHeaders []string
+	// ExposedHeaders are made accessible to the browser client
+	ExposedHeaders []string
+	// AllowCredentials permits cookies and Authorization headers
+	AllowCredentials bool
+	// MaxAge determines how long preflight results may be cached
+	MaxAge time.Duration
+}
+
+// originAllowed returns whether origin matches the configured policy
+func (c CORSConfig) originAllowed(origin string) bool {
+	if len(c.AllowedOrigins) == 0 {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	for _, o := range c.AllowedOrigins {
+		o = strings.ToLower(o)
+		if o == "*" || o == origin {
+			return true
+		}
+
+		if i := strings.Index(o, "*"); i >= 0 {
+			prefix, suffix := o[:i], o[i+1:]
+			if len(origin) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(origin, prefix) &&
+				strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// allowsAnyOrigin returns whether every origin is permitted
+func (c CORSConfig) allowsAnyOrigin() bool {
+	if len(c.AllowedOrigins) == 0 {
+		return true
+	}
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// headersAllowed returns whether all headers of a preflight's
+// Access-Control-Request-Headers are permitted
+func (c CORSConfig) headersAllowed(requested string) bool {
+	allowed := c.allowedHeaders()
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+
+		found := false
+		for _, a := range allowed {
+			if a == "*" || strings.EqualFold(a, h) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c CORSConfig) allowedHeaders() []string {
+	if len(c.AllowedHeaders) == 0 {
+		return defaultCORSHeaders
+	}
+	return c.AllowedHeaders
+}
+
+// setAllowOrigin sets the Access-Control-Allow-Origin & -Credentials headers
+// for an allowed origin
+func (c CORSConfig) setAllowOrigin(response *restful.Response, origin string) {
+	if c.allowsAnyOrigin() && !c.AllowCredentials {
+		response.Header().Set(restful.HEADER_AccessControlAllowOrigin, "*")
+		return
+	}
+
+	// The response differs per origin, caches must not share it
+	response.Header().Add("Vary", restful.HEADER_Origin)
+	if origin == "" {
+		return
+	}
+
+	response.Header().Set(restful.HEADER_AccessControlAllowOrigin, origin)
+	if c.AllowCredentials {
+		response.Header().Set(restful.HEADER_AccessControlAllowCredentials, "true")
+	}
+}
+
+func (s *Server) corsFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	if request.Request.Method != optionsReqIdentifier {
+		cors := s.Config.CORS
+		origin := request.Request.Header.Get(restful.HEADER_Origin)
+
+		if cors.originAllowed(origin) {
+			cors.setAllowOrigin(response, origin)
+			if origin != "" && len(cors.ExposedHeaders) > 0 {
+				response.Header().Set(restful.HEADER_AccessControlExposeHeaders,
+					strings.Join(cors.ExposedHeaders, ", "))
+			}
+		} else {
+			response.Header().Add("Vary", restful.HEADER_Origin)
+		}
+	}
+
+	chain.ProcessFilter(request, response)
+}
+
+func (s *Server) optionsFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	if request.Request.Method != optionsReqIdentifier {
+		chain.ProcessFilter(request, response)
+		return
+	}
+
+	methods := s.allowedMethods(request)
+	if len(methods) == 0 {
+		// unknown path, let the router respond with a 404
+		chain.ProcessFilter(request, response)
+		return
+	}
+	response.Header().Set(restful.HEADER_Allow, strings.Join(methods, ", "))
+
+	origin := request.Request.Header.Get(restful.HEADER_Origin)
+	reqMethod := request.Request.Header.Get(restful.HEADER_AccessControlRequestMethod)
+	if origin == "" || reqMethod == "" {
+		// not a CORS preflight
+		return
+	}
+
+	cors := s.Config.CORS
+	reqHeaders := request.Request.Header.Get(restful.HEADER_AccessControlRequestHeaders)
+	response.Header().Add("Vary", restful.HEADER_AccessControlRequestMethod)
+	response.Header().Add("Vary", restful.HEADER_AccessControlRequestHeaders)
+
+	var reason string
+	switch {
+	case !cors.originAllowed(origin):
+		reason = "Origin '" + origin + "' is not allowed"
+	case !containsMethod(methods, reqMethod):
+		reason = "Method '" + reqMethod + "' is not allowed"
+	case !cors.headersAllowed(reqHeaders):
+		reason = "Headers '" + reqHeaders + "' are not allowed"
+	}
+	if reason != "" {
+		response.Header().Add("Vary", restful.HEADER_Origin)
+		filterErrorResponse(request, response, nil, NewErrorResponse(
+			http.StatusForbidden,
+			reason,
+			"CORS preflight"))
+		return
+	}
+
+	cors.setAllowOrigin(response, origin)
+	response.Header().Set(restful.HEADER_AccessControlAllowMethods, strings.Join(methods, ", "))
+
+	allowedHeaders := cors.allowedHeaders()
+	if len(allowedHeaders) == 1 && allowedHeaders[0] == "*" {
+		// echo the requested headers, "*" isn't honored with credentials
+		if reqHeaders != "" {
+			response.Header().Set(restful.HEADER_AccessControlAllowHeaders, reqHeaders)
+		}
+	} else {
+		response.Header().Set(restful.HEADER_AccessControlAllowHeaders, strings.Join(allowedHeaders, ", "))
+	}
+
+	if cors.MaxAge > 0 {
+		response.Header().Set(restful.HEADER_AccessControlMaxAge,
+			strconv.Itoa(int(cors.MaxAge/time.Second)))
+	}
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
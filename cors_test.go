@@ -0,0 +1,176 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{nil, "https://example.com", true},
+		{[]string{"*"}, "https://example.com", true},
+		{[]string{"https://example.com"}, "https://example.com", true},
+		{[]string{"https://example.com"}, "HTTPS://EXAMPLE.COM", true},
+		{[]string{"https://example.com"}, "http://example.com", false},
+		{[]string{"https://example.com"}, "https://example.com.evil.com", false},
+		{[]string{"https://*.example.com"}, "https://api.example.com", true},
+		{[]string{"https://*.example.com"}, "https://a.b.example.com", true},
+		{[]string{"https://*.example.com"}, "https://example.com", false},
+		{[]string{"https://*.example.com"}, "https://.example.com", false},
+		{[]string{"https://*.example.com"}, "https://evilexample.com", false},
+		{[]string{"https://a.com", "https://b.com"}, "https://b.com", true},
+	}
+
+	for _, tt := range tests {
+		c := CORSConfig{AllowedOrigins: tt.allowed}
+		if got := c.originAllowed(tt.origin); got != tt.want {
+			t.Errorf("originAllowed(%q) with %v = %v, want %v", tt.origin, tt.allowed, got, tt.want)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	restricted := CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", "X-Custom"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+
+	tests := []struct {
+		name    string
+		config  CORSConfig
+		path    string
+		headers map[string]string
+
+		code         int
+		allowOrigin  string
+		allowMethods string
+		allowHeaders string
+	}{
+		{
+			name:         "any origin",
+			path:         "/test",
+			headers:      map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "GET"},
+			code:         http.StatusOK,
+			allowOrigin:  "*",
+			allowMethods: "GET",
+			allowHeaders: "authorization, content-type",
+		},
+		{
+			name:         "allowed origin",
+			config:       restricted,
+			path:         "/test/1",
+			headers:      map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "DELETE", "Access-Control-Request-Headers": "x-custom"},
+			code:         http.StatusOK,
+			allowOrigin:  "https://app.example.com",
+			allowMethods: "DELETE",
+			allowHeaders: "Authorization, Content-Type, X-Custom",
+		},
+		{
+			name:    "disallowed origin",
+			config:  restricted,
+			path:    "/test",
+			headers: map[string]string{"Origin": "https://evil.com", "Access-Control-Request-Method": "GET"},
+			code:    http.StatusForbidden,
+		},
+		{
+			name:    "disallowed method",
+			path:    "/test",
+			headers: map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "PUT"},
+			code:    http.StatusForbidden,
+		},
+		{
+			name:    "disallowed header",
+			config:  restricted,
+			path:    "/test",
+			headers: map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Other"},
+			code:    http.StatusForbidden,
+		},
+		{
+			name:         "any header",
+			config:       CORSConfig{AllowedHeaders: []string{"*"}},
+			path:         "/test",
+			headers:      map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Other"},
+			code:         http.StatusOK,
+			allowOrigin:  "*",
+			allowMethods: "GET",
+			allowHeaders: "X-Other",
+		},
+		{
+			name:    "plain OPTIONS",
+			path:    "/test",
+			headers: map[string]string{},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "unknown path",
+			path:    "/unknown",
+			headers: map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "GET"},
+			code:    http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(APIConfig{CORS: tt.config})
+			rec := serve(s, http.MethodOptions, tt.path, tt.headers)
+
+			if rec.Code != tt.code {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.code, rec.Body.String())
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, tt.allowMethods) {
+				t.Errorf("Access-Control-Allow-Methods = %q, want it to contain %q", got, tt.allowMethods)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Headers"); got != tt.allowHeaders {
+				t.Errorf("Access-Control-Allow-Headers = %q, want %q", got, tt.allowHeaders)
+			}
+			if tt.code == http.StatusForbidden && rec.Header().Get("Access-Control-Allow-Methods") != "" {
+				t.Error("rejected preflight allows methods")
+			}
+		})
+	}
+}
+
+func TestCORSRequest(t *testing.T) {
+	s := newTestServer(APIConfig{CORS: CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+	}})
+
+	rec := serve(s, http.MethodGet, "/test", map[string]string{"Origin": "https://app.example.com"})
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q for an allowed origin", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+	}
+	if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-ID" {
+		t.Errorf("Access-Control-Expose-Headers = %q, want X-Request-ID", got)
+	}
+
+	rec = serve(s, http.MethodGet, "/test", map[string]string{"Origin": "https://evil.com"})
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q for a disallowed origin", got)
+	}
+	if !strings.Contains(strings.Join(rec.Header()["Vary"], ","), "Origin") {
+		t.Errorf("Vary = %q, want it to contain Origin", rec.Header()["Vary"])
+	}
+}
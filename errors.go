@@ -8,8 +8,9 @@
 package smolder
 
 import (
+	"fmt"
+
 	"github.com/emicklei/go-restful"
-	log "github.com/sirupsen/logrus"
 )
 
 // APIError describes an API error
@@ -20,7 +21,9 @@ type APIError struct {
 	Source        struct {
 		Pointer string `json:"pointer"`
 	} `json:"source"`
-	Context string `json:"context,omitempty"`
+	Context   string `json:"context,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+	Stack     string `json:"stack,omitempty"`
 }
 
 // ErrorResponse is the default error handling response
@@ -59,15 +62,19 @@ func NewErrorResponse(code int, err interface{}, context string) *ErrorResponse
 
 // ErrorResponseHandler is the default error response handler
 func ErrorResponseHandler(request *restful.Request, response *restful.Response, origin error, err *ErrorResponse) {
-	fields := log.Fields{
+	fields := Fields{
 		"Internal":    err.Err[0].InternalError,
 		"Description": err.Err[0].Msg,
 		"Context":     err.Err[0].Context,
-		"URL":         request.Request.URL.String(),
+		"URL":         redactAccessToken(request.Request.URL.String()),
 		"Method":      request.Request.Method,
 	}
 
 	for k, vs := range request.Request.Form {
+		if k == AccessTokenParam {
+			fields[k] = redactedToken
+			continue
+		}
 		var out string
 		for i, v := range vs {
 			if i > 0 {
@@ -77,9 +84,21 @@ func ErrorResponseHandler(request *restful.Request, response *restful.Response,
 		}
 		fields[k] = out
 	}
-	log.WithFields(fields).Error(origin)
+	requestLogger(request).WithFields(fields).Error(fmt.Sprint(origin))
 
 	if response != nil {
+		id := RequestID(request)
+		for i := range err.Err {
+			err.Err[i].RequestID = id
+		}
+
 		response.WriteHeaderAndEntity(err.Err[0].Code, err)
 	}
 }
+
+// filterErrorResponse handles errors raised by container filters, which may
+// run before a route has been selected to negotiate the response's content type
+func filterErrorResponse(request *restful.Request, response *restful.Response, origin error, err *ErrorResponse) {
+	response.SetRequestAccepts(restful.MIME_JSON)
+	ErrorResponseHandler(request, response, origin, err)
+}
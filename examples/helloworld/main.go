@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"time"
 
 	"github.com/muesli/smolder"
 )
@@ -16,9 +20,26 @@ func main() {
 		PathPrefix: "",
 	}
 
-	wsContainer := smolder.NewSmolderContainer(smolderConfig, nil, nil)
-	(&HelloResource{}).Register(wsContainer, smolderConfig, context)
+	api := smolder.NewServer(smolderConfig)
+	(&HelloResource{Resource: smolder.Resource{Server: api}}).Register(api.Container, smolderConfig, context)
 
-	server := &http.Server{Addr: ":8080", Handler: wsContainer}
-	log.Fatal(server.ListenAndServe())
+	go shutdownOnInterrupt(api)
+
+	if err := api.ListenAndServe(":8080"); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// shutdownOnInterrupt drains all pending requests once an interrupt signal arrives
+func shutdownOnInterrupt(api *smolder.Server) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	<-sigs
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := api.Shutdown(ctx); err != nil {
+		log.Println(err)
+	}
 }
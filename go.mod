@@ -5,4 +5,5 @@ go 1.12
 require (
 	github.com/emicklei/go-restful v2.9.6+incompatible
 	github.com/sirupsen/logrus v1.4.2
+	gopkg.in/yaml.v2 v2.4.0
 )
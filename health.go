@@ -0,0 +1,189 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+const (
+	defaultLivenessPath  = "healthz"
+	defaultReadinessPath = "readyz"
+	defaultHealthTimeout = 5 * time.Second
+)
+
+// HealthCheckFunc checks a single dependency, e.g. by pinging a database
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthCheck is a named dependency check evaluated by the readiness endpoint
+type HealthCheck struct {
+	Name    string
+	Check   HealthCheckFunc
+	Timeout time.Duration
+}
+
+// HealthCheckResult is the outcome of a single HealthCheck
+type HealthCheckResult struct {
+	Healthy  bool   `json:"healthy"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HealthStatus is the response of the readiness endpoint
+type HealthStatus struct {
+	Ready        bool                         `json:"ready"`
+	ShuttingDown bool                         `json:"shuttingDown"`
+	Checks       map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// LivenessStatus is the response of the liveness endpoint
+type LivenessStatus struct {
+	Alive bool `json:"alive"`
+}
+
+// AddHealthCheck registers a named dependency check with the readiness
+// endpoint. A timeout of zero uses the configured default.
+func (s *Server) AddHealthCheck(name string, timeout time.Duration, check HealthCheckFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Config.Health.Checks = append(s.Config.Health.Checks, HealthCheck{
+		Name:    name,
+		Check:   check,
+		Timeout: timeout,
+	})
+}
+
+// Health runs all registered dependency checks concurrently and reports
+// whether the Server is ready to accept traffic
+func (s *Server) Health(ctx context.Context) HealthStatus {
+	s.mu.Lock()
+	checks := append([]HealthCheck{}, s.Config.Health.Checks...)
+	status := HealthStatus{
+		Ready:        !s.isShuttingDown(),
+		ShuttingDown: s.isShuttingDown(),
+		Checks:       make(map[string]HealthCheckResult, len(checks)),
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c HealthCheck) {
+			defer wg.Done()
+
+			timeout := c.Timeout
+			if timeout == 0 {
+				timeout = s.Config.Health.Timeout
+			}
+			if timeout == 0 {
+				timeout = defaultHealthTimeout
+			}
+			res := runHealthCheck(ctx, c.Check, timeout)
+
+			mu.Lock()
+			defer mu.Unlock()
+			status.Checks[c.Name] = res
+			if !res.Healthy {
+				status.Ready = false
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return status
+}
+
+// runHealthCheck runs check and gives up once timeout expired, even if the
+// check itself doesn't honor its context
+func runHealthCheck(ctx context.Context, check HealthCheckFunc, timeout time.Duration) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = errors.New("check timed out after " + timeout.String())
+	}
+
+	res := HealthCheckResult{
+		Healthy:  err == nil,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func (s *Server) registerHealth() {
+	livenessPath := s.Config.Health.LivenessPath
+	if livenessPath == "" {
+		livenessPath = defaultLivenessPath
+	}
+	readinessPath := s.Config.Health.ReadinessPath
+	if readinessPath == "" {
+		readinessPath = defaultReadinessPath
+	}
+
+	s.healthPaths = map[string]bool{}
+	for _, p := range []string{livenessPath, readinessPath} {
+		ws := new(restful.WebService)
+		ws.Path("/" + s.Config.PathPrefix + p).
+			Produces(restful.MIME_JSON)
+
+		if p == livenessPath {
+			ws.Route(ws.GET("").To(s.liveness).
+				Doc("liveness probe").
+				Returns(http.StatusOK, "OK", LivenessStatus{}))
+		} else {
+			ws.Route(ws.GET("").To(s.readiness).
+				Doc("readiness probe").
+				Returns(http.StatusOK, "OK", HealthStatus{}).
+				Returns(http.StatusServiceUnavailable, "Not ready", HealthStatus{}))
+		}
+
+		for _, r := range ws.Routes() {
+			s.healthPaths[r.Path] = true
+		}
+		s.Container.Add(ws)
+	}
+}
+
+// isHealthRequest returns true if request was routed to a health endpoint
+func (s *Server) isHealthRequest(request *restful.Request) bool {
+	return s.healthPaths[request.SelectedRoutePath()]
+}
+
+func (s *Server) liveness(request *restful.Request, response *restful.Response) {
+	response.WriteHeaderAndEntity(http.StatusOK, LivenessStatus{Alive: true})
+}
+
+func (s *Server) readiness(request *restful.Request, response *restful.Response) {
+	status := s.Health(request.Request.Context())
+
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	response.WriteHeaderAndEntity(code, status)
+}
@@ -0,0 +1,572 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+const (
+	defaultJWTClockSkew    = time.Minute
+	defaultJWKSRefresh     = time.Hour
+	minJWKSRefresh         = 10 * time.Second
+	defaultJWKSHTTPTimeout = 10 * time.Second
+)
+
+// JWT verification errors
+var (
+	ErrInvalidToken      = errors.New("Invalid token")
+	ErrInvalidSignature  = errors.New("Invalid token signature")
+	ErrUnknownKey        = errors.New("Unknown token signing key")
+	ErrTokenExpired      = errors.New("Token expired")
+	ErrMissingExpiration = errors.New("Token has no expiration")
+	ErrTokenNotYetValid  = errors.New("Token not yet valid")
+	ErrInvalidIssuer     = errors.New("Invalid token issuer")
+	ErrInvalidAudience   = errors.New("Invalid token audience")
+)
+
+// JWTConfig contains the keys and expectations for verifying JSON Web Tokens
+type JWTConfig struct {
+	// HMACKeyFile contains the shared secret for HS256 signed tokens
+	HMACKeyFile string `smolder:"secret"`
+	// PublicKeyFiles contain PEM encoded RSA or ECDSA (P-256) public keys or
+	// certificates for RS256 and ES256 signed tokens
+	PublicKeyFiles []string
+	// JWKSURL is the location of a JSON Web Key Set with RS256 and ES256
+	// keys. It gets refreshed every JWKSRefresh, which defaults to an hour,
+	// and whenever a token refers to an unknown key ID.
+	JWKSURL     string
+	JWKSRefresh time.Duration
+	// HTTPClient fetches the JWKS, defaults to a client with a 10s timeout
+	HTTPClient *http.Client `json:"-"`
+
+	// Issuer must match the token's iss claim if set
+	Issuer string
+	// Audience must be contained in the token's aud claim if set
+	Audience string
+	// ClockSkew is tolerated when checking exp and nbf, defaults to 1m
+	ClockSkew time.Duration
+	// RequireExpiration rejects tokens without an exp claim
+	RequireExpiration bool
+}
+
+// Claims are the verified claims of a JSON Web Token
+type Claims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	ID        string
+
+	// Raw contains all claims, including the registered ones
+	Raw map[string]interface{}
+
+	payload []byte
+}
+
+// Identity returns the token's subject
+func (c *Claims) Identity() string {
+	return c.Subject
+}
+
+// Scopes returns the scopes granted by the token's space-delimited scope
+// claim, or by its scp claim, a string or a list
+func (c *Claims) Scopes() []string {
+	if s, ok := c.Raw["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+	switch scp := c.Raw["scp"].(type) {
+	case string:
+		return strings.Fields(scp)
+	case []interface{}:
+		scopes, _ := stringOrList(scp)
+		return scopes
+	}
+	return nil
+}
+
+// Decode unmarshals the token's claims into v, e.g. a struct with custom
+// claims
+func (c *Claims) Decode(v interface{}) error {
+	return json.Unmarshal(c.payload, v)
+}
+
+// JWTAuthenticator verifies JSON Web Tokens signed with HS256, RS256 or
+// ES256. Embed it in an APIContext to authenticate requests by their access
+// token: Authentication returns the token's *Claims, which SetAuth receives.
+type JWTAuthenticator struct {
+	config  JWTConfig
+	hmacKey []byte
+	keys    []crypto.PublicKey
+
+	mu          sync.RWMutex
+	jwks        map[string]crypto.PublicKey
+	jwksFetched time.Time
+	fetch       *jwksFetch
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// NewJWTAuthenticator loads the keys configured in config. It fetches the
+// JWKS if configured and fails if it's unavailable.
+func NewJWTAuthenticator(config JWTConfig) (*JWTAuthenticator, error) {
+	a := &JWTAuthenticator{config: config}
+	if a.config.ClockSkew == 0 {
+		a.config.ClockSkew = defaultJWTClockSkew
+	}
+	if a.config.JWKSRefresh <= 0 {
+		a.config.JWKSRefresh = defaultJWKSRefresh
+	}
+	if a.config.HTTPClient == nil {
+		a.config.HTTPClient = &http.Client{Timeout: defaultJWKSHTTPTimeout}
+	}
+
+	if config.HMACKeyFile != "" {
+		key, err := ioutil.ReadFile(config.HMACKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		a.hmacKey = bytes.TrimRight(key, "\r\n")
+		if len(a.hmacKey) == 0 {
+			return nil, errors.New("Empty HMAC key in " + config.HMACKeyFile)
+		}
+	}
+	for _, f := range config.PublicKeyFiles {
+		key, err := loadPublicKey(f)
+		if err != nil {
+			return nil, err
+		}
+		a.keys = append(a.keys, key)
+	}
+	if config.JWKSURL != "" {
+		if err := a.refreshJWKS(); err != nil {
+			return nil, err
+		}
+	}
+
+	if a.hmacKey == nil && len(a.keys) == 0 && config.JWKSURL == "" {
+		return nil, errors.New("No JWT verification keys configured")
+	}
+	return a, nil
+}
+
+// Authentication verifies the request's access token and returns its
+// *Claims. Requests without an access token are anonymous, so nil is
+// returned without an error.
+func (a *JWTAuthenticator) Authentication(request *restful.Request) (interface{}, error) {
+	token := AccessToken(request)
+	if token == "" {
+		return nil, nil
+	}
+
+	claims, err := a.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Verify checks the token's signature and claims and returns its Claims
+func (a *JWTAuthenticator) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := a.verifySignature(header, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims, err := parseClaims(payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// verifySignature checks sig with the keys suitable for the header's alg
+func (a *JWTAuthenticator) verifySignature(header jwtHeader, signed string, sig []byte) error {
+	if header.Alg == "HS256" {
+		if a.hmacKey == nil {
+			return ErrUnknownKey
+		}
+		mac := hmac.New(sha256.New, a.hmacKey)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+
+	var verify func(key crypto.PublicKey, hash []byte) bool
+	switch header.Alg {
+	case "RS256":
+		verify = func(key crypto.PublicKey, hash []byte) bool {
+			k, ok := key.(*rsa.PublicKey)
+			return ok && rsa.VerifyPKCS1v15(k, crypto.SHA256, hash, sig) == nil
+		}
+	case "ES256":
+		verify = func(key crypto.PublicKey, hash []byte) bool {
+			k, ok := key.(*ecdsa.PublicKey)
+			if !ok || k.Curve != elliptic.P256() || len(sig) != 64 {
+				return false
+			}
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			return ecdsa.Verify(k, hash, r, s)
+		}
+	default:
+		return ErrInvalidToken
+	}
+
+	hash := sha256.Sum256([]byte(signed))
+	keys := a.candidateKeys(header.Kid)
+	if len(keys) == 0 {
+		return ErrUnknownKey
+	}
+	for _, key := range keys {
+		if verify(key, hash[:]) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// candidateKeys returns the keys a token signed with key ID kid may be
+// verified with
+func (a *JWTAuthenticator) candidateKeys(kid string) []crypto.PublicKey {
+	if a.config.JWKSURL != "" {
+		a.mu.RLock()
+		_, known := a.jwks[kid]
+		age := time.Since(a.jwksFetched)
+		fetching := a.fetch != nil
+		a.mu.RUnlock()
+
+		switch {
+		case kid != "" && !known && age >= minJWKSRefresh:
+			// the keys may have been rotated, wait for the new ones. If the
+			// JWKS is unavailable, keep using the previous keys.
+			a.refreshJWKS()
+		case age > a.config.JWKSRefresh && !fetching:
+			// keep verifying with the current keys in the meantime
+			go a.refreshJWKS()
+		}
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if key, ok := a.jwks[kid]; ok && kid != "" {
+		return []crypto.PublicKey{key}
+	}
+	keys := append([]crypto.PublicKey(nil), a.keys...)
+	if kid == "" {
+		for _, key := range a.jwks {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// validate checks the time based claims, the issuer and the audience
+func (a *JWTAuthenticator) validate(claims *Claims) error {
+	now := time.Now()
+	if claims.ExpiresAt.IsZero() {
+		if a.config.RequireExpiration {
+			return ErrMissingExpiration
+		}
+	} else if now.After(claims.ExpiresAt.Add(a.config.ClockSkew)) {
+		return ErrTokenExpired
+	}
+	if !claims.NotBefore.IsZero() && now.Add(a.config.ClockSkew).Before(claims.NotBefore) {
+		return ErrTokenNotYetValid
+	}
+	if a.config.Issuer != "" && claims.Issuer != a.config.Issuer {
+		return ErrInvalidIssuer
+	}
+	if a.config.Audience != "" && !containsString(claims.Audience, a.config.Audience) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// refreshJWKS fetches the key set from JWKSURL. Concurrent callers share a
+// single fetch, which happens without holding the lock, so verifying tokens
+// with the current keys never waits for it.
+func (a *JWTAuthenticator) refreshJWKS() error {
+	a.mu.Lock()
+	if f := a.fetch; f != nil {
+		a.mu.Unlock()
+		<-f.done
+		return f.err
+	}
+	// another request may have refreshed the keys in the meantime
+	if a.jwks != nil && time.Since(a.jwksFetched) < minJWKSRefresh {
+		a.mu.Unlock()
+		return nil
+	}
+	f := &jwksFetch{done: make(chan struct{})}
+	a.fetch = f
+	a.mu.Unlock()
+
+	keys, err := a.fetchJWKS()
+
+	a.mu.Lock()
+	// also rate limits retries of failed fetches
+	a.jwksFetched = time.Now()
+	if err == nil {
+		a.jwks = keys
+	}
+	a.fetch = nil
+	a.mu.Unlock()
+
+	f.err = err
+	close(f.done)
+	return err
+}
+
+// fetchJWKS downloads and parses the key set from JWKSURL
+func (a *JWTAuthenticator) fetchJWKS() (map[string]crypto.PublicKey, error) {
+	resp, err := a.config.HTTPClient.Get(a.config.JWKSURL)
+	if err != nil {
+		return nil, errors.New("Can't fetch JWKS: " + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Can't fetch JWKS: " + resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, errors.New("Can't parse JWKS: " + err.Error())
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key := k.publicKey(); key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// jwksFetch is a JWKS fetch in progress
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// jwk is a JSON Web Key
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey returns the RSA or P-256 key, or nil for unsupported keys
+func (k jwk) publicKey() crypto.PublicKey {
+	switch k.Kty {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil {
+			return nil
+		}
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil
+		}
+		return key
+	}
+	return nil
+}
+
+// loadPublicKey reads a PEM encoded public key or certificate
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("No PEM data found in " + path)
+	}
+
+	var key crypto.PublicKey
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		return nil, errors.New("Unsupported PEM block " + block.Type + " in " + path)
+	}
+	if err != nil {
+		return nil, errors.New("Can't parse public key in " + path + ": " + err.Error())
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("Unsupported ECDSA curve in " + path)
+		}
+	default:
+		return nil, errors.New("Unsupported public key type in " + path)
+	}
+	return key, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// parseClaims decodes a token's payload
+func parseClaims(payload []byte) (*Claims, error) {
+	claims := &Claims{payload: payload}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(&claims.Raw); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var ok bool
+	for name, v := range claims.Raw {
+		switch name {
+		case "iss":
+			claims.Issuer, ok = v.(string)
+		case "sub":
+			claims.Subject, ok = v.(string)
+		case "jti":
+			claims.ID, ok = v.(string)
+		case "aud":
+			claims.Audience, ok = stringOrList(v)
+		case "exp":
+			claims.ExpiresAt, ok = numericDate(v)
+		case "nbf":
+			claims.NotBefore, ok = numericDate(v)
+		case "iat":
+			claims.IssuedAt, ok = numericDate(v)
+		default:
+			ok = true
+		}
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+	}
+	return claims, nil
+}
+
+// numericDate converts a JWT NumericDate, the seconds since the epoch
+func numericDate(v interface{}) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))), true
+}
+
+// stringOrList converts a claim that is either a string or a list of them
+func stringOrList(v interface{}) ([]string, bool) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, true
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			list = append(list, s)
+		}
+		return list, true
+	}
+	return nil, false
+}
@@ -0,0 +1,461 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testHMACSecret = "s3cret"
+
+var (
+	testRSAKey = mustRSAKey()
+	testECKey  = mustECKey()
+)
+
+func mustRSAKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func mustECKey() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+type signer func(signed []byte) []byte
+
+func hmacSigner(secret []byte) signer {
+	return func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+}
+
+func rsaSigner(key *rsa.PrivateKey) signer {
+	return func(signed []byte) []byte {
+		hash := sha256.Sum256(signed)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+		if err != nil {
+			panic(err)
+		}
+		return sig
+	}
+}
+
+func ecSigner(key *ecdsa.PrivateKey) signer {
+	return func(signed []byte) []byte {
+		hash := sha256.Sum256(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+		if err != nil {
+			panic(err)
+		}
+		return append(padInt(r, 32), padInt(s, 32)...)
+	}
+}
+
+func padInt(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	return append(make([]byte, size-len(b)), b...)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// makeToken creates a JWT with the given header fields and claims
+func makeToken(alg, kid string, claims map[string]interface{}, sign signer) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+
+	signed := b64(h) + "." + b64(c)
+	return signed + "." + b64(sign([]byte(signed)))
+}
+
+// rsaJWK returns the JWKS representation of an RSA public key
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   b64(key.N.Bytes()),
+		"e":   b64(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// jwksServer serves a JWKS, which can be replaced while it's running
+type jwksServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	keys    []map[string]string
+	fetches int
+	block   chan struct{}
+}
+
+func newJWKSServer(keys ...map[string]string) *jwksServer {
+	js := &jwksServer{keys: keys}
+	js.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		js.mu.Lock()
+		js.fetches++
+		block := js.block
+		keys := js.keys
+		js.mu.Unlock()
+
+		if block != nil {
+			<-block
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	return js
+}
+
+func (js *jwksServer) setKeys(keys ...map[string]string) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.keys = keys
+}
+
+func (js *jwksServer) fetchCount() int {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	return js.fetches
+}
+
+// writeKeyFiles writes the HMAC secret and the EC public key to dir
+func writeKeyFiles(t *testing.T, dir string) (hmacFile, ecFile string) {
+	hmacFile = filepath.Join(dir, "hmac")
+	if err := ioutil.WriteFile(hmacFile, []byte(testHMACSecret+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&testECKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecFile = filepath.Join(dir, "ec.pem")
+	if err := ioutil.WriteFile(ecFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return hmacFile, ecFile
+}
+
+func TestJWTVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smolder-jwt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hmacFile, ecFile := writeKeyFiles(t, dir)
+
+	jwks := newJWKSServer(rsaJWK("r1", &testRSAKey.PublicKey))
+	defer jwks.Close()
+
+	a, err := NewJWTAuthenticator(JWTConfig{
+		HMACKeyFile:    hmacFile,
+		PublicKeyFiles: []string{ecFile},
+		JWKSURL:        jwks.URL,
+		Issuer:         "https://issuer.example.com",
+		Audience:       "api",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Unix()
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "alice",
+			"iss": "https://issuer.example.com",
+			"aud": "api",
+			"exp": now + 60,
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+
+	hs := hmacSigner([]byte(testHMACSecret))
+	rs := rsaSigner(testRSAKey)
+	es := ecSigner(testECKey)
+	ecPEM, _ := ioutil.ReadFile(ecFile)
+	valid := makeToken("HS256", "", claims(nil), hs)
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"HS256", valid, nil},
+		{"RS256 from JWKS", makeToken("RS256", "r1", claims(nil), rs), nil},
+		{"RS256 without kid", makeToken("RS256", "", claims(nil), rs), nil},
+		{"ES256 from file", makeToken("ES256", "", claims(nil), es), nil},
+
+		{"malformed", "abc", ErrInvalidToken},
+		{"two segments", "a.b", ErrInvalidToken},
+		{"invalid base64", "!!.!!.!!", ErrInvalidToken},
+		{"tampered payload", strings.Replace(valid, ".", "."+b64([]byte(`{"sub":"bob"}`))+"x", 1), ErrInvalidSignature},
+		{"no signature", valid[:strings.LastIndex(valid, ".")+1], ErrInvalidSignature},
+
+		// algorithm confusion
+		{"alg none", makeToken("none", "", claims(nil), func([]byte) []byte { return nil }), ErrInvalidToken},
+		{"unsupported alg", makeToken("HS512", "", claims(nil), hs), ErrInvalidToken},
+		{"HS256 signed with public key", makeToken("HS256", "", claims(nil), hmacSigner(ecPEM)), ErrInvalidSignature},
+		{"RS256 header, HMAC signature", makeToken("RS256", "r1", claims(nil), hs), ErrInvalidSignature},
+		{"ES256 header, RSA signature", makeToken("ES256", "", claims(nil), rs), ErrInvalidSignature},
+		{"RS256 header, ECDSA signature", makeToken("RS256", "", claims(nil), es), ErrInvalidSignature},
+
+		// time based claims, tolerating a minute of clock skew
+		{"expired", makeToken("HS256", "", claims(map[string]interface{}{"exp": now - 120}), hs), ErrTokenExpired},
+		{"expired within skew", makeToken("HS256", "", claims(map[string]interface{}{"exp": now - 30}), hs), nil},
+		{"not yet valid", makeToken("HS256", "", claims(map[string]interface{}{"nbf": now + 120}), hs), ErrTokenNotYetValid},
+		{"not yet valid within skew", makeToken("HS256", "", claims(map[string]interface{}{"nbf": now + 30}), hs), nil},
+		{"no expiration", makeToken("HS256", "", claims(map[string]interface{}{"exp": nil}), hs), nil},
+		{"fractional expiration", makeToken("HS256", "", claims(map[string]interface{}{"exp": float64(now) + 60.5}), hs), nil},
+		{"string expiration", makeToken("HS256", "", claims(map[string]interface{}{"exp": "tomorrow"}), hs), ErrInvalidToken},
+
+		// issuer and audience
+		{"wrong issuer", makeToken("HS256", "", claims(map[string]interface{}{"iss": "https://evil.com"}), hs), ErrInvalidIssuer},
+		{"no issuer", makeToken("HS256", "", claims(map[string]interface{}{"iss": nil}), hs), ErrInvalidIssuer},
+		{"wrong audience", makeToken("HS256", "", claims(map[string]interface{}{"aud": "other"}), hs), ErrInvalidAudience},
+		{"audience list", makeToken("HS256", "", claims(map[string]interface{}{"aud": []string{"other", "api"}}), hs), nil},
+		{"audience list without api", makeToken("HS256", "", claims(map[string]interface{}{"aud": []string{"other"}}), hs), ErrInvalidAudience},
+		{"no audience", makeToken("HS256", "", claims(map[string]interface{}{"aud": nil}), hs), ErrInvalidAudience},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := a.Verify(tt.token)
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if c != nil {
+					t.Errorf("got claims %+v with error %v", c, err)
+				}
+				return
+			}
+			if c.Subject != "alice" {
+				t.Errorf("got subject %q, want alice", c.Subject)
+			}
+		})
+	}
+}
+
+func TestJWTWithoutHMACKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smolder-jwt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, ecFile := writeKeyFiles(t, dir)
+
+	a, err := NewJWTAuthenticator(JWTConfig{PublicKeyFiles: []string{ecFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a token "signed" with the public key as HMAC secret must not verify
+	ecPEM, _ := ioutil.ReadFile(ecFile)
+	token := makeToken("HS256", "", map[string]interface{}{"sub": "mallory"}, hmacSigner(ecPEM))
+	if _, err := a.Verify(token); err != ErrUnknownKey {
+		t.Errorf("got error %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestJWTRequireExpiration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smolder-jwt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hmacFile, _ := writeKeyFiles(t, dir)
+
+	a, err := NewJWTAuthenticator(JWTConfig{HMACKeyFile: hmacFile, RequireExpiration: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs := hmacSigner([]byte(testHMACSecret))
+	if _, err := a.Verify(makeToken("HS256", "", map[string]interface{}{"sub": "alice"}, hs)); err != ErrMissingExpiration {
+		t.Errorf("got error %v, want %v", err, ErrMissingExpiration)
+	}
+	exp := time.Now().Unix() + 60
+	if _, err := a.Verify(makeToken("HS256", "", map[string]interface{}{"sub": "alice", "exp": exp}, hs)); err != nil {
+		t.Errorf("got error %v for a token with expiration", err)
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	oldKey := testRSAKey
+	newKey := mustRSAKey()
+
+	jwks := newJWKSServer(rsaJWK("old", &oldKey.PublicKey))
+	defer jwks.Close()
+
+	a, err := NewJWTAuthenticator(JWTConfig{JWKSURL: jwks.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]interface{}{"sub": "alice", "exp": time.Now().Unix() + 60}
+	oldToken := makeToken("RS256", "old", claims, rsaSigner(oldKey))
+	newToken := makeToken("RS256", "new", claims, rsaSigner(newKey))
+
+	if _, err := a.Verify(oldToken); err != nil {
+		t.Fatalf("got error %v for the current key", err)
+	}
+
+	jwks.setKeys(rsaJWK("new", &newKey.PublicKey))
+
+	// unknown key IDs don't trigger a fetch right after the last one
+	if _, err := a.Verify(newToken); err != ErrUnknownKey {
+		t.Errorf("got error %v right after the last fetch, want %v", err, ErrUnknownKey)
+	}
+	if n := jwks.fetchCount(); n != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", n)
+	}
+
+	// pretend the last fetch happened a while ago
+	a.mu.Lock()
+	a.jwksFetched = time.Now().Add(-time.Minute)
+	a.mu.Unlock()
+
+	if _, err := a.Verify(newToken); err != nil {
+		t.Errorf("got error %v for the rotated key", err)
+	}
+	if n := jwks.fetchCount(); n != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", n)
+	}
+	if _, err := a.Verify(oldToken); err == nil {
+		t.Error("the retired key is still accepted")
+	}
+}
+
+func TestJWKSRefreshDoesNotBlock(t *testing.T) {
+	jwks := newJWKSServer(rsaJWK("r1", &testRSAKey.PublicKey))
+	defer jwks.Close()
+
+	a, err := NewJWTAuthenticator(JWTConfig{JWKSURL: jwks.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// make all further fetches hang until released
+	block := make(chan struct{})
+	jwks.mu.Lock()
+	jwks.block = block
+	jwks.mu.Unlock()
+	defer close(block)
+
+	a.mu.Lock()
+	a.jwksFetched = time.Now().Add(-time.Minute)
+	a.mu.Unlock()
+
+	claims := map[string]interface{}{"sub": "alice", "exp": time.Now().Unix() + 60}
+	go a.Verify(makeToken("RS256", "unknown", claims, rsaSigner(testRSAKey)))
+
+	// wait for the fetch to start
+	for i := 0; jwks.fetchCount() < 2; i++ {
+		if i > 100 {
+			t.Fatal("JWKS wasn't fetched for an unknown key ID")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := a.Verify(makeToken("RS256", "r1", claims, rsaSigner(testRSAKey)))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("got error %v for a known key", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("verification with a known key waits for the JWKS fetch")
+	}
+}
+
+func TestClaims(t *testing.T) {
+	payload := `{"sub":"alice","aud":["a","b"],"exp":1500000000,"iat":1400000000.5,"jti":"1","scope":"read write","name":"Alice"}`
+	c, err := parseClaims([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Identity() != "alice" {
+		t.Errorf("got identity %q, want alice", c.Identity())
+	}
+	if !reflect.DeepEqual(c.Audience, []string{"a", "b"}) {
+		t.Errorf("got audience %v", c.Audience)
+	}
+	if !c.ExpiresAt.Equal(time.Unix(1500000000, 0)) {
+		t.Errorf("got expiration %v", c.ExpiresAt)
+	}
+	if !c.IssuedAt.Equal(time.Unix(1400000000, int64(time.Second/2))) {
+		t.Errorf("got issued at %v", c.IssuedAt)
+	}
+	if !reflect.DeepEqual(c.Scopes(), []string{"read", "write"}) {
+		t.Errorf("got scopes %v", c.Scopes())
+	}
+
+	var custom struct {
+		Name string `json:"name"`
+	}
+	if err := c.Decode(&custom); err != nil || custom.Name != "Alice" {
+		t.Errorf("got custom claims %+v, %v", custom, err)
+	}
+
+	c, err = parseClaims([]byte(`{"scp":["read","admin"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Scopes(), []string{"read", "admin"}) {
+		t.Errorf("got scopes %v from scp", c.Scopes())
+	}
+}
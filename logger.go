@@ -0,0 +1,139 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+	"github.com/sirupsen/logrus"
+)
+
+const loggerAttribute = "logger"
+
+// Fields contains the structured data attached to a log entry
+type Fields map[string]interface{}
+
+// Logger is the interface smolder emits all its log entries through
+type Logger interface {
+	WithFields(fields Fields) Logger
+
+	Debug(msg string)
+	Info(msg string)
+	Warn(msg string)
+	Error(msg string)
+}
+
+// LevelLogger can optionally be implemented by a Logger whose level can be
+// changed at runtime, e.g. via the admin container
+type LevelLogger interface {
+	Level() string
+	SetLevel(level string) error
+}
+
+// ErrLevelUnsupported is returned when changing the level of a Logger that
+// doesn't implement LevelLogger
+var ErrLevelUnsupported = errors.New("Logger doesn't support changing its level")
+
+// defaultLogger is used unless APIConfig specifies a Logger
+var defaultLogger = NewLogrusLogger(logrus.StandardLogger())
+
+// logger returns the Logger configured in config or the default one
+func (config APIConfig) logger() Logger {
+	if config.Logger != nil {
+		return config.Logger
+	}
+	return defaultLogger
+}
+
+// requestLogger returns the Logger for request, tagged with the request's ID
+func requestLogger(request *restful.Request) Logger {
+	if l, ok := request.Attribute(loggerAttribute).(Logger); ok {
+		return l
+	}
+	return defaultLogger.WithFields(Fields{"RequestID": RequestID(request)})
+}
+
+type logrusLogger struct {
+	logger logrus.FieldLogger
+}
+
+// NewLogrusLogger returns a Logger writing to a logrus Logger or Entry
+func NewLogrusLogger(logger logrus.FieldLogger) Logger {
+	return logrusLogger{logger: logger}
+}
+
+func (l logrusLogger) WithFields(fields Fields) Logger {
+	return logrusLogger{logger: l.logger.WithFields(logrus.Fields(fields))}
+}
+
+func (l logrusLogger) Debug(msg string) { l.logger.Debug(msg) }
+func (l logrusLogger) Info(msg string)  { l.logger.Info(msg) }
+func (l logrusLogger) Warn(msg string)  { l.logger.Warn(msg) }
+func (l logrusLogger) Error(msg string) { l.logger.Error(msg) }
+
+// base returns the logrus Logger the entries are written to
+func (l logrusLogger) base() *logrus.Logger {
+	switch logger := l.logger.(type) {
+	case *logrus.Logger:
+		return logger
+	case *logrus.Entry:
+		return logger.Logger
+	}
+	return nil
+}
+
+func (l logrusLogger) Level() string {
+	if logger := l.base(); logger != nil {
+		return logger.GetLevel().String()
+	}
+	return ""
+}
+
+func (l logrusLogger) SetLevel(level string) error {
+	logger := l.base()
+	if logger == nil {
+		return ErrLevelUnsupported
+	}
+
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logger.SetLevel(lvl)
+	return nil
+}
+
+type discardLogger struct{}
+
+// DiscardLogger returns a Logger that drops all log entries, e.g. to keep
+// tests quiet
+func DiscardLogger() Logger {
+	return discardLogger{}
+}
+
+func (l discardLogger) WithFields(fields Fields) Logger { return l }
+func (l discardLogger) Debug(msg string)                {}
+func (l discardLogger) Info(msg string)                 {}
+func (l discardLogger) Warn(msg string)                 {}
+func (l discardLogger) Error(msg string)                {}
+
+// restfulLogger routes go-restful's own log output through a Logger
+type restfulLogger struct {
+	logger Logger
+}
+
+func (l restfulLogger) Print(v ...interface{}) {
+	l.logger.Warn(strings.TrimSpace(fmt.Sprint(v...)))
+}
+
+func (l restfulLogger) Printf(format string, v ...interface{}) {
+	l.logger.Warn(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
@@ -0,0 +1,78 @@
+//go:build go1.21
+// +build go1.21
+
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+	level  *slog.LevelVar
+}
+
+// NewSlogLogger returns a Logger writing to a log/slog Logger
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return slogLogger{logger: logger}
+}
+
+// NewSlogLevelLogger returns a Logger writing to a log/slog Logger whose
+// handler is configured with level, e.g. via slog.HandlerOptions. The level
+// can be changed at runtime via the admin container.
+func NewSlogLevelLogger(logger *slog.Logger, level *slog.LevelVar) Logger {
+	return slogLogger{logger: logger, level: level}
+}
+
+func (l slogLogger) WithFields(fields Fields) Logger {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := make([]interface{}, 0, len(fields)*2)
+	for _, k := range keys {
+		args = append(args, k, fields[k])
+	}
+	return slogLogger{logger: l.logger.With(args...), level: l.level}
+}
+
+func (l slogLogger) Debug(msg string) { l.logger.Debug(msg) }
+func (l slogLogger) Info(msg string)  { l.logger.Info(msg) }
+func (l slogLogger) Warn(msg string)  { l.logger.Warn(msg) }
+func (l slogLogger) Error(msg string) { l.logger.Error(msg) }
+
+func (l slogLogger) Level() string {
+	if l.level == nil {
+		return ""
+	}
+	return strings.ToLower(l.level.Level().String())
+}
+
+func (l slogLogger) SetLevel(level string) error {
+	if l.level == nil {
+		return ErrLevelUnsupported
+	}
+
+	// accept the level names of logrus, too
+	if strings.EqualFold(level, "warning") {
+		level = "warn"
+	}
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return errors.New("Invalid log level " + level)
+	}
+	l.level.Set(lvl)
+	return nil
+}
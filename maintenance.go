@@ -0,0 +1,295 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+const (
+	defaultMaintenancePath = "maintenance"
+
+	// defaultAdminMaxBodySize limits the request bodies of admin endpoints
+	// unless APIConfig.MaxBodySize is set
+	defaultAdminMaxBodySize = 64 << 10
+)
+
+var (
+	// ErrMaintenance is the error of requests rejected because their resource
+	// is under maintenance
+	ErrMaintenance = errors.New("Resource is under maintenance")
+
+	errAdminAuthRequired = errors.New("Admin authentication required")
+	errUnknownResource   = errors.New("Unknown resource")
+)
+
+// MaintenanceConfig contains the parameters for the maintenance admin
+// endpoint. Maintenance mode itself is always available via
+// Server.SetMaintenance.
+type MaintenanceConfig struct {
+	// Endpoint registers an admin endpoint to list, set and clear
+	// maintenance at runtime
+	Endpoint bool
+	// Path of the admin endpoint, defaults to "maintenance"
+	Path string
+	// Context authenticates the admin endpoint's requests, which are
+	// rejected unless Authentication returns a non-nil user
+	Context APIContextFactory `json:"-"`
+}
+
+// Maintenance puts a Resource into maintenance, rejecting its requests with
+// a 503
+type Maintenance struct {
+	// Resource is the Name of the Resource
+	Resource string
+	// ReadOnly only rejects mutating requests: POST, PUT, PATCH and DELETE
+	ReadOnly bool
+	// Message is returned to clients, defaults to "Resource is under
+	// maintenance"
+	Message string
+	// RetryAfter is advertised to clients if set
+	RetryAfter time.Duration
+}
+
+// MaintenanceStatus is the representation of a Maintenance on the admin
+// endpoint
+type MaintenanceStatus struct {
+	Resource string `json:"resource"`
+	ReadOnly bool   `json:"readOnly"`
+	Message  string `json:"message,omitempty"`
+	// RetryAfter in seconds
+	RetryAfter int64 `json:"retryAfter,omitempty"`
+}
+
+// SetMaintenance puts a Resource into maintenance, replacing any previous
+// maintenance of the same Resource
+func (s *Server) SetMaintenance(m Maintenance) {
+	s.maintenanceMu.Lock()
+	defer s.maintenanceMu.Unlock()
+
+	s.maintenance[m.Resource] = m
+	s.Config.logger().WithFields(Fields{
+		"Resource": m.Resource,
+		"ReadOnly": m.ReadOnly,
+	}).Info("Resource entered maintenance")
+}
+
+// ClearMaintenance ends the maintenance of the Resource called resource
+func (s *Server) ClearMaintenance(resource string) {
+	s.maintenanceMu.Lock()
+	defer s.maintenanceMu.Unlock()
+
+	if _, ok := s.maintenance[resource]; ok {
+		delete(s.maintenance, resource)
+		s.Config.logger().WithFields(Fields{"Resource": resource}).Info("Resource left maintenance")
+	}
+}
+
+// Maintenance returns all Resources currently under maintenance, sorted by
+// their name
+func (s *Server) Maintenance() []Maintenance {
+	s.maintenanceMu.RLock()
+	defer s.maintenanceMu.RUnlock()
+
+	m := make([]Maintenance, 0, len(s.maintenance))
+	for _, v := range s.maintenance {
+		m = append(m, v)
+	}
+	sort.Slice(m, func(i, j int) bool {
+		return m[i].Resource < m[j].Resource
+	})
+	return m
+}
+
+// maintenanceFor returns the maintenance affecting method on resource
+func (s *Server) maintenanceFor(resource, method string) (Maintenance, bool) {
+	s.maintenanceMu.RLock()
+	defer s.maintenanceMu.RUnlock()
+
+	m, ok := s.maintenance[resource]
+	if !ok {
+		return m, false
+	}
+	if m.ReadOnly {
+		switch method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return m, false
+		}
+	}
+	return m, true
+}
+
+func (s *Server) maintenanceFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	method := request.Request.Method
+	resource := s.resourceName(method, request.SelectedRoutePath())
+	m, ok := s.maintenanceFor(resource, method)
+	if resource == "" || !ok {
+		chain.ProcessFilter(request, response)
+		return
+	}
+
+	msg := m.Message
+	if msg == "" {
+		msg = ErrMaintenance.Error()
+	}
+	if m.RetryAfter > 0 {
+		response.Header().Set("Retry-After", formatSeconds(m.RetryAfter))
+	}
+	filterErrorResponse(request, response, ErrMaintenance, NewErrorResponse(
+		http.StatusServiceUnavailable,
+		msg,
+		method))
+}
+
+func (s *Server) registerMaintenance() {
+	path := s.Config.Maintenance.Path
+	if path == "" {
+		path = defaultMaintenancePath
+	}
+
+	ws := new(restful.WebService)
+	ws.Path("/" + s.Config.PathPrefix + path).
+		Doc("Maintenance mode of resources").
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON)
+
+	ws.Route(ws.GET("").To(s.listMaintenance).
+		Doc("list resources under maintenance").
+		Returns(http.StatusOK, "OK", []MaintenanceStatus{}).
+		Returns(http.StatusUnauthorized, "Authorization required", ErrorResponse{}))
+	ws.Route(ws.PUT("/{resource}").To(s.putMaintenance).
+		Doc("put a resource into maintenance").
+		Filter(bodyFilter(s.adminMaxBodySize())).
+		Param(ws.PathParameter("resource", "Name of the resource").DataType("string")).
+		Reads(MaintenanceStatus{}).
+		Returns(http.StatusOK, "OK", MaintenanceStatus{}).
+		Returns(http.StatusBadRequest, "Invalid put data", ErrorResponse{}).
+		Returns(http.StatusUnauthorized, "Authorization required", ErrorResponse{}).
+		Returns(http.StatusNotFound, "Unknown resource", ErrorResponse{}).
+		Returns(http.StatusRequestEntityTooLarge, "Request body too large", ErrorResponse{}))
+	ws.Route(ws.DELETE("/{resource}").To(s.deleteMaintenance).
+		Doc("end the maintenance of a resource").
+		Param(ws.PathParameter("resource", "Name of the resource").DataType("string")).
+		Returns(http.StatusNoContent, "No content", nil).
+		Returns(http.StatusUnauthorized, "Authorization required", ErrorResponse{}).
+		Returns(http.StatusNotFound, "Unknown resource", ErrorResponse{}))
+
+	s.Container.Add(ws)
+}
+
+func (s *Server) listMaintenance(request *restful.Request, response *restful.Response) {
+	if !s.authenticateAdmin(request, response, s.Config.Maintenance.Context) {
+		return
+	}
+
+	status := []MaintenanceStatus{}
+	for _, m := range s.Maintenance() {
+		status = append(status, maintenanceStatus(m))
+	}
+	response.WriteEntity(status)
+}
+
+func (s *Server) putMaintenance(request *restful.Request, response *restful.Response) {
+	if !s.authenticateAdmin(request, response, s.Config.Maintenance.Context) {
+		return
+	}
+	if !s.knownResource(request, response) {
+		return
+	}
+
+	var status MaintenanceStatus
+	if err := request.ReadEntity(&status); err != nil {
+		bodyReadError(request, response, err, "PUT")
+		return
+	}
+
+	m := Maintenance{
+		Resource:   request.PathParameter("resource"),
+		ReadOnly:   status.ReadOnly,
+		Message:    status.Message,
+		RetryAfter: time.Duration(status.RetryAfter) * time.Second,
+	}
+	s.SetMaintenance(m)
+	response.WriteEntity(maintenanceStatus(m))
+}
+
+func (s *Server) deleteMaintenance(request *restful.Request, response *restful.Response) {
+	if !s.authenticateAdmin(request, response, s.Config.Maintenance.Context) {
+		return
+	}
+	if !s.knownResource(request, response) {
+		return
+	}
+
+	s.ClearMaintenance(request.PathParameter("resource"))
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// knownResource responds with a 404 and returns false unless the resource
+// path parameter names a registered Resource
+func (s *Server) knownResource(request *restful.Request, response *restful.Response) bool {
+	if _, ok := s.Resource(request.PathParameter("resource")); ok {
+		return true
+	}
+
+	ErrorResponseHandler(request, response, errUnknownResource, NewErrorResponse(
+		http.StatusNotFound,
+		errUnknownResource,
+		request.Request.Method))
+	return false
+}
+
+// adminMaxBodySize returns the maximum request body size of admin endpoints
+func (s *Server) adminMaxBodySize() int64 {
+	if s.Config.MaxBodySize > 0 {
+		return s.Config.MaxBodySize
+	}
+	return defaultAdminMaxBodySize
+}
+
+func maintenanceStatus(m Maintenance) MaintenanceStatus {
+	return MaintenanceStatus{
+		Resource:   m.Resource,
+		ReadOnly:   m.ReadOnly,
+		Message:    m.Message,
+		RetryAfter: int64(m.RetryAfter / time.Second),
+	}
+}
+
+// authenticateAdmin authenticates a request to an admin endpoint, accepting
+// access tokens as configured in APIConfig.Auth. It responds with a 401 and
+// returns false unless context's Authentication returns a user.
+func (s *Server) authenticateAdmin(request *restful.Request, response *restful.Response, context APIContextFactory) bool {
+	request.SetAttribute(authConfigAttribute, s.Config.Auth)
+
+	var auth interface{}
+	err := errAdminAuthRequired
+	if context != nil {
+		ctx := context.NewAPIContext()
+		if auth, err = ctx.Authentication(request); err == nil && auth != nil {
+			ctx.SetAuth(auth)
+			request.SetAttribute(authAttribute, auth)
+			return true
+		}
+	}
+
+	if err == nil {
+		err = errAdminAuthRequired
+	}
+	ErrorResponseHandler(request, response, err, NewErrorResponse(
+		http.StatusUnauthorized,
+		"Invalid accesstoken",
+		request.Request.Method))
+	return false
+}
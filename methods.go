@@ -0,0 +1,51 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+)
+
+var probedMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// allowedMethods returns the HTTP methods routed for the request's path,
+// i.e. exactly the methods the matching Resource supports
+func (s *Server) allowedMethods(request *restful.Request) []string {
+	var router restful.CurlyRouter
+	webServices := s.Container.RegisteredWebServices()
+
+	methods := []string{}
+	for _, m := range probedMethods {
+		probe := *request.Request
+		probe.Method = m
+
+		_, _, err := router.SelectRoute(webServices, &probe)
+		if err != nil {
+			if serr, ok := err.(restful.ServiceError); ok &&
+				(serr.Code == http.StatusNotFound || serr.Code == http.StatusMethodNotAllowed) {
+				continue
+			}
+		}
+		methods = append(methods, m)
+	}
+
+	return methods
+}
+
+// serviceErrorHandler writes the errors raised during route selection and
+// advertises the supported methods on a 405
+func (s *Server) serviceErrorHandler(err restful.ServiceError, request *restful.Request, response *restful.Response) {
+	if err.Code == http.StatusMethodNotAllowed {
+		response.Header().Set(restful.HEADER_Allow, strings.Join(s.allowedMethods(request), ", "))
+	}
+
+	response.WriteErrorString(err.Code, err.Message)
+}
@@ -0,0 +1,277 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+const (
+	defaultMetricsPath      = "metrics"
+	defaultMetricsNamespace = "smolder"
+	metricsContentType      = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	defaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	defaultSizeBuckets     = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+// MetricsConfig contains the parameters for recording request metrics
+type MetricsConfig struct {
+	// Enabled records metrics for all requests
+	Enabled bool
+	// Endpoint serves the metrics in the Prometheus text format
+	Endpoint bool
+	// Path of the metrics endpoint, defaults to "metrics"
+	Path string
+	// Namespace prefixes all metric names, defaults to "smolder"
+	Namespace string
+	// DurationBuckets are the upper bounds of the latency histogram in seconds
+	DurationBuckets []float64
+	// SizeBuckets are the upper bounds of the response size histogram in bytes
+	SizeBuckets []float64
+}
+
+type routeLabels struct {
+	resource string
+	method   string
+	route    string
+}
+
+type requestLabels struct {
+	routeLabels
+	code int
+}
+
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// metrics keeps track of all request metrics of a Server
+type metrics struct {
+	mu        sync.Mutex
+	requests  map[requestLabels]uint64
+	durations map[routeLabels]*histogram
+	sizes     map[routeLabels]*histogram
+
+	durationBuckets []float64
+	sizeBuckets     []float64
+}
+
+func newMetrics(config MetricsConfig) *metrics {
+	m := &metrics{
+		requests:        make(map[requestLabels]uint64),
+		durations:       make(map[routeLabels]*histogram),
+		sizes:           make(map[routeLabels]*histogram),
+		durationBuckets: append([]float64(nil), config.DurationBuckets...),
+		sizeBuckets:     append([]float64(nil), config.SizeBuckets...),
+	}
+	if len(m.durationBuckets) == 0 {
+		m.durationBuckets = append(m.durationBuckets, defaultDurationBuckets...)
+	}
+	if len(m.sizeBuckets) == 0 {
+		m.sizeBuckets = append(m.sizeBuckets, defaultSizeBuckets...)
+	}
+	sort.Float64s(m.durationBuckets)
+	sort.Float64s(m.sizeBuckets)
+
+	return m
+}
+
+func (m *metrics) observe(labels routeLabels, code int, duration time.Duration, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestLabels{labels, code}]++
+
+	h, ok := m.durations[labels]
+	if !ok {
+		h = newHistogram(m.durationBuckets)
+		m.durations[labels] = h
+	}
+	h.observe(duration.Seconds())
+
+	h, ok = m.sizes[labels]
+	if !ok {
+		h = newHistogram(m.sizeBuckets)
+		m.sizes[labels] = h
+	}
+	h.observe(float64(size))
+}
+
+func (s *Server) metricsFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	start := time.Now()
+	chain.ProcessFilter(request, response)
+
+	labels := routeLabels{
+		method: metricsMethod(request.Request.Method),
+		route:  "unmatched",
+	}
+	if request.SelectedRoutePath() != "" {
+		labels.route = routeTemplate(request)
+		labels.resource = s.resourceName(request.Request.Method, request.SelectedRoutePath())
+	}
+
+	s.metrics.observe(labels, response.StatusCode(), time.Since(start), response.ContentLength())
+}
+
+// metricsMethod returns the label for method. Clients may send arbitrary
+// methods, which must not create new time series.
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
+
+func (s *Server) registerMetrics() {
+	path := s.Config.Metrics.Path
+	if path == "" {
+		path = defaultMetricsPath
+	}
+
+	ws := new(restful.WebService)
+	ws.Path("/" + s.Config.PathPrefix + path).
+		Produces("text/plain")
+	ws.Route(ws.GET("").To(s.serveMetrics).
+		Doc("metrics in the Prometheus text exposition format"))
+
+	s.Container.Add(ws)
+}
+
+func (s *Server) serveMetrics(request *restful.Request, response *restful.Response) {
+	response.Header().Set(restful.HEADER_ContentType, metricsContentType)
+	response.WriteHeader(http.StatusOK)
+	if err := s.WriteMetrics(response); err != nil {
+		requestLogger(request).WithFields(Fields{"Error": err}).Warn("Can't write metrics")
+	}
+}
+
+// WriteMetrics writes all recorded metrics in the Prometheus text
+// exposition format to w
+func (s *Server) WriteMetrics(w io.Writer) error {
+	ns := s.Config.Metrics.Namespace
+	if ns == "" {
+		ns = defaultMetricsNamespace
+	}
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "# HELP %s_requests_in_flight Number of requests currently being processed.\n", ns)
+	fmt.Fprintf(bw, "# TYPE %s_requests_in_flight gauge\n", ns)
+	fmt.Fprintf(bw, "%s_requests_in_flight %d\n", ns, s.PendingRequests())
+
+	if s.metrics == nil {
+		return bw.Flush()
+	}
+	m := s.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	requests := make([]requestLabels, 0, len(m.requests))
+	for l := range m.requests {
+		requests = append(requests, l)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].routeLabels != requests[j].routeLabels {
+			return requests[i].routeLabels.less(requests[j].routeLabels)
+		}
+		return requests[i].code < requests[j].code
+	})
+
+	fmt.Fprintf(bw, "# HELP %s_requests_total Total number of handled requests.\n", ns)
+	fmt.Fprintf(bw, "# TYPE %s_requests_total counter\n", ns)
+	for _, l := range requests {
+		fmt.Fprintf(bw, "%s_requests_total{%s,code=\"%d\"} %d\n", ns, l.routeLabels, l.code, m.requests[l])
+	}
+
+	writeHistograms(bw, ns+"_request_duration_seconds", "Request latencies in seconds.", m.durations)
+	writeHistograms(bw, ns+"_response_size_bytes", "Response sizes in bytes.", m.sizes)
+
+	return bw.Flush()
+}
+
+func writeHistograms(w io.Writer, name, help string, histograms map[routeLabels]*histogram) {
+	labels := make([]routeLabels, 0, len(histograms))
+	for l := range histograms {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].less(labels[j])
+	})
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, l := range labels {
+		h := histograms[l]
+		for i, b := range h.bounds {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, l, formatFloat(b), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, l, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, l, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, l, h.count)
+	}
+}
+
+func (l routeLabels) less(o routeLabels) bool {
+	if l.resource != o.resource {
+		return l.resource < o.resource
+	}
+	if l.route != o.route {
+		return l.route < o.route
+	}
+	return l.method < o.method
+}
+
+// String formats the labels in the Prometheus text format
+func (l routeLabels) String() string {
+	return fmt.Sprintf("resource=\"%s\",method=\"%s\",route=\"%s\"",
+		escapeLabel(l.resource), escapeLabel(l.method), escapeLabel(l.route))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,269 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+const (
+	rateLimitedAttribute = "rateLimited"
+	rateLimitSweepPeriod = time.Minute
+)
+
+// ErrRateLimited is the error reported to clients exceeding their rate limit
+var ErrRateLimited = errors.New("Rate limit exceeded")
+
+// RateLimit allows Limit requests per Period, in bursts of up to Limit
+// requests. The zero value disables rate limiting.
+type RateLimit struct {
+	Limit  int
+	Period time.Duration
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Limit > 0 && l.Period > 0
+}
+
+// RateLimitConfig contains the parameters for rate limiting API clients
+type RateLimitConfig struct {
+	// Default applies to all resources that don't define their own limits
+	Default RateLimit
+	// Store keeps track of the clients' token buckets, defaults to an
+	// in-memory store per Server, or per Resource without a Server
+	Store RateLimitStore `json:"-"`
+}
+
+// RateLimitStatus is the state of a client's token bucket after taking a token
+type RateLimitStatus struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitStore manages token buckets for rate limiting
+type RateLimitStore interface {
+	// Take tries to remove a token from the bucket identified by key
+	Take(key string, limit RateLimit) (RateLimitStatus, error)
+}
+
+// GetRateLimitSupported can be implemented by Resources to override the rate
+// limit for GET requests
+type GetRateLimitSupported interface {
+	GetRateLimit() RateLimit
+}
+
+// PostRateLimitSupported can be implemented by Resources to override the rate
+// limit for POST requests
+type PostRateLimitSupported interface {
+	PostRateLimit() RateLimit
+}
+
+// PutRateLimitSupported can be implemented by Resources to override the rate
+// limit for PUT requests
+type PutRateLimitSupported interface {
+	PutRateLimit() RateLimit
+}
+
+// PatchRateLimitSupported can be implemented by Resources to override the
+// rate limit for PATCH requests
+type PatchRateLimitSupported interface {
+	PatchRateLimit() RateLimit
+}
+
+// DeleteRateLimitSupported can be implemented by Resources to override the
+// rate limit for DELETE requests
+type DeleteRateLimitSupported interface {
+	DeleteRateLimit() RateLimit
+}
+
+// RateLimitSupported can be implemented by Resources to override the rate
+// limit for all of their methods
+type RateLimitSupported interface {
+	RateLimit() RateLimit
+}
+
+// rateLimitFor returns the rate limit for method and the scope its token
+// buckets are shared in
+func (r Resource) rateLimitFor(method string) (RateLimit, string) {
+	var l RateLimit
+	switch method {
+	case http.MethodGet:
+		if res, ok := r.Parent.(GetRateLimitSupported); ok {
+			l = res.GetRateLimit()
+		}
+	case http.MethodPost:
+		if res, ok := r.Parent.(PostRateLimitSupported); ok {
+			l = res.PostRateLimit()
+		}
+	case http.MethodPut:
+		if res, ok := r.Parent.(PutRateLimitSupported); ok {
+			l = res.PutRateLimit()
+		}
+	case http.MethodPatch:
+		if res, ok := r.Parent.(PatchRateLimitSupported); ok {
+			l = res.PatchRateLimit()
+		}
+	case http.MethodDelete:
+		if res, ok := r.Parent.(DeleteRateLimitSupported); ok {
+			l = res.DeleteRateLimit()
+		}
+	}
+	if l.enabled() {
+		return l, r.Name + " " + method
+	}
+
+	if res, ok := r.Parent.(RateLimitSupported); ok && res.RateLimit().enabled() {
+		return res.RateLimit(), r.Name
+	}
+	return r.Config.RateLimit.Default, ""
+}
+
+// newRateLimitStore returns the configured RateLimitStore, the one of the
+// Server the Resource is registered with, or a new in-memory store for
+// Resources without a Server
+func (r Resource) newRateLimitStore() RateLimitStore {
+	if r.Config.RateLimit.Store != nil {
+		return r.Config.RateLimit.Store
+	}
+	if r.Server != nil {
+		return r.Server.rateLimitStore
+	}
+	return NewMemoryRateLimitStore()
+}
+
+// rateLimit takes a token from the bucket of the authenticated user, or the
+// client's IP if auth doesn't implement Identifier. It responds with a 429
+// and returns false if the client exceeded its rate limit.
+func (r Resource) rateLimit(request *restful.Request, response *restful.Response, method string, auth interface{}) bool {
+	if request.Attribute(rateLimitedAttribute) != nil {
+		// already accounted for, e.g. GetByIDs called by Get
+		return true
+	}
+	limit, scope := r.rateLimitFor(method)
+	if !limit.enabled() || r.rateLimits == nil {
+		return true
+	}
+	request.SetAttribute(rateLimitedAttribute, true)
+
+	key := "ip:" + ClientIP(request.Request, r.Config.TrustedProxies)
+	if id := identity(auth); id != "" {
+		key = "auth:" + id
+	}
+
+	status, err := r.rateLimits.Take(scope+"|"+key, limit)
+	if err != nil {
+		// rather serve too many requests than none at all
+		requestLogger(request).WithFields(Fields{"Error": err}).Warn("Rate limit store failed")
+		return true
+	}
+
+	response.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Limit))
+	response.Header().Set("RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	response.Header().Set("RateLimit-Reset", formatSeconds(status.Reset))
+
+	if !status.Allowed {
+		response.Header().Set("Retry-After", formatSeconds(status.RetryAfter))
+		ErrorResponseHandler(request, response, ErrRateLimited, NewErrorResponse(
+			http.StatusTooManyRequests,
+			ErrRateLimited,
+			method))
+		return false
+	}
+
+	return true
+}
+
+// formatSeconds rounds d up to full seconds
+func formatSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// MemoryRateLimitStore is a RateLimitStore keeping its token buckets in memory
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	limit  RateLimit
+}
+
+// NewMemoryRateLimitStore returns a new, empty MemoryRateLimitStore
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// refill adds the tokens accumulated since the bucket was last used
+func (b *tokenBucket) refill(now time.Time) {
+	rate := float64(b.limit.Limit) / b.limit.Period.Seconds()
+	b.tokens = math.Min(float64(b.limit.Limit), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+}
+
+// Take tries to remove a token from the bucket identified by key
+func (s *MemoryRateLimitStore) Take(key string, limit RateLimit) (RateLimitStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok || b.limit != limit {
+		b = &tokenBucket{
+			tokens: float64(limit.Limit),
+			last:   now,
+			limit:  limit,
+		}
+		s.buckets[key] = b
+	}
+	b.refill(now)
+
+	rate := float64(limit.Limit) / limit.Period.Seconds()
+	status := RateLimitStatus{}
+	if b.tokens >= 1 {
+		b.tokens--
+		status.Allowed = true
+	} else {
+		status.RetryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	status.Remaining = int(b.tokens)
+	status.Reset = time.Duration((float64(limit.Limit) - b.tokens) / rate * float64(time.Second))
+
+	return status, nil
+}
+
+// sweep drops buckets that refilled completely, must be called with s.mu held
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < rateLimitSweepPeriod {
+		return
+	}
+	s.lastSweep = now
+
+	for k, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Limit) {
+			delete(s.buckets, k)
+		}
+	}
+}
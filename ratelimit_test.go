@@ -0,0 +1,152 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// limitedResource limits GET requests to one per minute
+type limitedResource struct {
+	testResource
+}
+
+func (r *limitedResource) GetRateLimit() RateLimit {
+	return RateLimit{Limit: 1, Period: time.Minute}
+}
+
+func TestRateLimitWithoutServer(t *testing.T) {
+	config := APIConfig{
+		Logger:    DiscardLogger(),
+		RateLimit: RateLimitConfig{Default: RateLimit{Limit: 1, Period: time.Minute}},
+	}
+	container := NewSmolderContainer(config, nil, nil)
+
+	r := &testResource{}
+	r.Name = "test"
+	r.TypeName = "test"
+	r.Endpoint = "test"
+	r.Config = config
+	r.Context = &testContext{}
+	r.Init(container, r)
+
+	var codes []int
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		container.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test", nil))
+		codes = append(codes, rec.Code)
+
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Error("rate limited response is missing Retry-After")
+		}
+	}
+
+	if want := []int{200, 429, 429}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("got status codes %v, want %v", codes, want)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		config RateLimit
+		method string
+		path   string
+		codes  []int
+	}{
+		{
+			name:   "disabled",
+			method: http.MethodGet,
+			path:   "/test",
+			codes:  []int{200, 200, 200},
+		},
+		{
+			name:   "default limit",
+			config: RateLimit{Limit: 2, Period: time.Minute},
+			method: http.MethodGet,
+			path:   "/test",
+			codes:  []int{200, 200, 429},
+		},
+		{
+			name:   "default limit for DELETE",
+			config: RateLimit{Limit: 1, Period: time.Minute},
+			method: http.MethodDelete,
+			path:   "/test/1",
+			codes:  []int{200, 429, 429},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(APIConfig{RateLimit: RateLimitConfig{Default: tt.config}})
+
+			var codes []int
+			for range tt.codes {
+				codes = append(codes, serve(s, tt.method, tt.path, nil).Code)
+			}
+			if !reflect.DeepEqual(codes, tt.codes) {
+				t.Errorf("got status codes %v, want %v", codes, tt.codes)
+			}
+		})
+	}
+}
+
+func TestRateLimitOverride(t *testing.T) {
+	s := NewServer(APIConfig{Logger: DiscardLogger()})
+
+	r := &limitedResource{}
+	register(s, &r.Resource, r, "limited")
+
+	get := serve(s, http.MethodGet, "/limited", nil)
+	if get.Code != http.StatusOK || get.Header().Get("RateLimit-Limit") != "1" {
+		t.Errorf("got status %d, RateLimit-Limit %q for the first GET", get.Code, get.Header().Get("RateLimit-Limit"))
+	}
+	if code := serve(s, http.MethodGet, "/limited", nil).Code; code != http.StatusTooManyRequests {
+		t.Errorf("got status %d for the second GET, want 429", code)
+	}
+
+	// DELETE doesn't share the GET limit
+	for i := 0; i < 3; i++ {
+		if code := serve(s, http.MethodDelete, "/limited/1", nil).Code; code != http.StatusOK {
+			t.Errorf("got status %d for an unlimited DELETE", code)
+		}
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	s := NewMemoryRateLimitStore()
+	limit := RateLimit{Limit: 2, Period: time.Minute}
+
+	tests := []struct {
+		key       string
+		allowed   bool
+		remaining int
+	}{
+		{"a", true, 1},
+		{"a", true, 0},
+		{"a", false, 0},
+		{"b", true, 1},
+	}
+
+	for i, tt := range tests {
+		status, err := s.Take(tt.key, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Allowed != tt.allowed || status.Remaining != tt.remaining {
+			t.Errorf("%d: Take(%q) = %+v, want allowed %v, remaining %d", i, tt.key, status, tt.allowed, tt.remaining)
+		}
+		if !status.Allowed && (status.RetryAfter <= 0 || status.RetryAfter > 30*time.Second) {
+			t.Errorf("%d: Take(%q) retry after %v, want up to 30s", i, tt.key, status.RetryAfter)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/emicklei/go-restful"
+)
+
+// recoveryFilter answers requests whose handler or filters panicked with a 500
+// ErrorResponse, unless parts of the response were already written
+func (s *Server) recoveryFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	tw := &writeTracker{ResponseWriter: response.ResponseWriter}
+	response.ResponseWriter = tw
+
+	defer func() {
+		response.ResponseWriter = tw.ResponseWriter
+
+		r := recover()
+		if r == nil {
+			return
+		}
+		if r == http.ErrAbortHandler {
+			// deliberately aborted, let net/http deal with it
+			panic(r)
+		}
+
+		stack := string(debug.Stack())
+		requestLogger(request).WithFields(Fields{
+			"Method": request.Request.Method,
+			"URL":    redactAccessToken(request.Request.URL.String()),
+			"Stack":  stack,
+		}).Error(fmt.Sprintf("Recovered from panic: %v", r))
+
+		if tw.written {
+			// too late, the status or parts of the response are already on the
+			// wire
+			return
+		}
+
+		err := NewErrorResponse(
+			http.StatusInternalServerError,
+			"Internal server error",
+			"panic")
+		if s.Config.Debug {
+			err.Err[0].Msg = fmt.Sprintf("%v", r)
+			err.Err[0].Stack = stack
+		}
+		err.Err[0].RequestID = RequestID(request)
+
+		response.SetRequestAccepts(restful.MIME_JSON)
+		response.WriteHeaderAndEntity(http.StatusInternalServerError, err)
+	}()
+
+	chain.ProcessFilter(request, response)
+}
+
+// writeTracker records whether the status or body of a response have been
+// written
+type writeTracker struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *writeTracker) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *writeTracker) Write(p []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher
+func (w *writeTracker) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.written = true
+		f.Flush()
+	}
+}
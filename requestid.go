@@ -0,0 +1,62 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"encoding/hex"
+
+	"github.com/emicklei/go-restful"
+)
+
+const (
+	// HeaderRequestID is the header used to pass request IDs between
+	// clients and services
+	HeaderRequestID = "X-Request-ID"
+
+	requestIDAttribute = "requestID"
+	maxRequestIDLength = 128
+)
+
+// RequestID returns the ID of a request
+func RequestID(request *restful.Request) string {
+	id, _ := request.Attribute(requestIDAttribute).(string)
+	return id
+}
+
+func (s *Server) requestIDFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	id := request.Request.Header.Get(HeaderRequestID)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+
+	request.SetAttribute(requestIDAttribute, id)
+	request.SetAttribute(loggerAttribute, s.Config.logger().WithFields(Fields{"RequestID": id}))
+	response.Header().Set(HeaderRequestID, id)
+
+	chain.ProcessFilter(request, response)
+}
+
+// validRequestID rejects empty, overly long and non-printable IDs, which we
+// don't want to copy into our logs and responses
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	randomBytes(b)
+	return hex.EncodeToString(b)
+}
@@ -12,7 +12,6 @@ import (
 	"reflect"
 
 	"github.com/emicklei/go-restful"
-	log "github.com/sirupsen/logrus"
 )
 
 // APIResource contains all the functions required to register a new API resource
@@ -30,7 +29,15 @@ type Resource struct {
 	Config  APIConfig
 	Context APIContextFactory
 
+	// Server the Resource gets registered with. If set, the Resource shares
+	// the Server's logger and rate limit store and shows up in its route
+	// listing.
+	Server *Server
+
 	Parent interface{}
+
+	limiter    *limiter
+	rateLimits RateLimitStore
 }
 
 // GetIDSupported is the interface Resources need to fulfill to respond to GET-by-ID requests
@@ -92,9 +99,12 @@ type DeleteSupported interface {
 
 // Init registers a resource with the Container and sets up all the supported routes
 func (r Resource) Init(container *restful.Container, resource interface{}) {
-	log.WithField("Resource", r.Name).Info("Registering Resource")
-	ws := new(restful.WebService)
 	r.Parent = resource
+	r.logger().WithFields(Fields{"Resource": r.Name}).Info("Registering Resource")
+
+	ws := new(restful.WebService)
+	r.limiter = r.newLimiter()
+	r.rateLimits = r.newRateLimitStore()
 
 	ws.Path("/" + r.Config.PathPrefix + r.Endpoint).
 		Doc(r.Doc).
@@ -113,15 +123,14 @@ func (r Resource) Init(container *restful.Container, resource interface{}) {
 				Required(true).
 				AllowMultiple(false))
 
-		if resource.GetByIDsAuthRequired() {
+		authRequired := r.authRequired(http.MethodGet, resource.GetByIDsAuthRequired())
+		route.Metadata(MetadataAuthRequired, authRequired)
+		if authRequired {
 			route.Returns(http.StatusUnauthorized, "Authorization required", ErrorResponse{})
-			route.Param(restful.QueryParameter("accesstoken", "accesstoken required for auth").
-				DataType("string").
-				Required(true).
-				AllowMultiple(false))
+			r.authParams(route)
 		}
 
-		ws.Route(route)
+		r.addRoute(ws, http.MethodGet, route)
 	}
 
 	isGetSupported := false
@@ -132,12 +141,11 @@ func (r Resource) Init(container *restful.Container, resource interface{}) {
 			Returns(http.StatusOK, "OK", resource.Returns()).
 			Returns(http.StatusNotFound, "Not found", ErrorResponse{})
 
-		if resource.GetAuthRequired() {
+		authRequired := r.authRequired(http.MethodGet, resource.GetAuthRequired())
+		route.Metadata(MetadataAuthRequired, authRequired)
+		if authRequired {
 			route.Returns(http.StatusUnauthorized, "Authorization required", ErrorResponse{})
-			route.Param(restful.QueryParameter("accesstoken", "accesstoken required for auth").
-				DataType("string").
-				Required(true).
-				AllowMultiple(false))
+			r.authParams(route)
 		}
 
 		for _, p := range resource.GetParams() {
@@ -149,7 +157,7 @@ func (r Resource) Init(container *restful.Container, resource interface{}) {
 				// Required(true).
 				AllowMultiple(true))
 		}
-		ws.Route(route)
+		r.addRoute(ws, http.MethodGet, route)
 	}
 
 	if isDatabaseItem && !isGetSupported {
@@ -159,9 +167,10 @@ func (r Resource) Init(container *restful.Container, resource interface{}) {
 			Param(ws.QueryParameter("ids[]", "IDs of "+r.TypeName+"s").
 				DataType("string").
 				// Required(true).
-				AllowMultiple(true))
+				AllowMultiple(true)).
+			Metadata(MetadataAuthRequired, r.authRequired(http.MethodGet, resource.(GetIDSupported).GetByIDsAuthRequired()))
 
-		ws.Route(route)
+		r.addRoute(ws, http.MethodGet, route)
 	}
 
 	if resource, ok := resource.(PostSupported); ok {
@@ -171,19 +180,18 @@ func (r Resource) Init(container *restful.Container, resource interface{}) {
 			Returns(http.StatusOK, "OK", resource.Returns()).
 			Returns(http.StatusBadRequest, "Invalid post data", ErrorResponse{})
 
-		if resource.PostAuthRequired() {
+		authRequired := r.authRequired(http.MethodPost, resource.PostAuthRequired())
+		route.Metadata(MetadataAuthRequired, authRequired)
+		if authRequired {
 			route.Returns(http.StatusUnauthorized, "Authorization required", ErrorResponse{})
-			route.Param(restful.QueryParameter("accesstoken", "accesstoken required for auth").
-				DataType("string").
-				Required(true).
-				AllowMultiple(false))
+			r.authParams(route)
 		}
 
 		for _, p := range resource.PostParams() {
 			route.Param(p)
 		}
 
-		ws.Route(route)
+		r.addRoute(ws, http.MethodPost, route)
 	}
 
 	if resource, ok := resource.(PutSupported); ok {
@@ -194,12 +202,11 @@ func (r Resource) Init(container *restful.Container, resource interface{}) {
 			Returns(http.StatusNotFound, "Not found", ErrorResponse{}).
 			Returns(http.StatusBadRequest, "Invalid put data", ErrorResponse{})
 
-		if resource.PutAuthRequired() {
+		authRequired := r.authRequired(http.MethodPut, resource.PutAuthRequired())
+		route.Metadata(MetadataAuthRequired, authRequired)
+		if authRequired {
 			route.Returns(http.StatusUnauthorized, "Authorization required", ErrorResponse{})
-			route.Param(restful.QueryParameter("accesstoken", "accesstoken required for auth").
-				DataType("string").
-				Required(true).
-				AllowMultiple(false))
+			r.authParams(route)
 		}
 
 		for _, p := range resource.PutParams() {
@@ -210,7 +217,7 @@ func (r Resource) Init(container *restful.Container, resource interface{}) {
 			Required(true).
 			AllowMultiple(false))
 
-		ws.Route(route)
+		r.addRoute(ws, http.MethodPut, route)
 	}
 
 	if resource, ok := resource.(PatchSupported); ok {
@@ -221,12 +228,11 @@ func (r Resource) Init(container *restful.Container, resource interface{}) {
 			Returns(http.StatusNotFound, "Not found", ErrorResponse{}).
 			Returns(http.StatusBadRequest, "Invalid patch data", ErrorResponse{})
 
-		if resource.PatchAuthRequired() {
+		authRequired := r.authRequired(http.MethodPatch, resource.PatchAuthRequired())
+		route.Metadata(MetadataAuthRequired, authRequired)
+		if authRequired {
 			route.Returns(http.StatusUnauthorized, "Authorization required", ErrorResponse{})
-			route.Param(restful.QueryParameter("accesstoken", "accesstoken required for auth").
-				DataType("string").
-				Required(true).
-				AllowMultiple(false))
+			r.authParams(route)
 		}
 
 		for _, p := range resource.PatchParams() {
@@ -237,7 +243,7 @@ func (r Resource) Init(container *restful.Container, resource interface{}) {
 			Required(true).
 			AllowMultiple(false))
 
-		ws.Route(route)
+		r.addRoute(ws, http.MethodPatch, route)
 	}
 
 	if resource, ok := resource.(DeleteSupported); ok {
@@ -245,12 +251,11 @@ func (r Resource) Init(container *restful.Container, resource interface{}) {
 			Doc(resource.DeleteDoc()).
 			Returns(http.StatusNotFound, "Not found", ErrorResponse{})
 
-		if resource.DeleteAuthRequired() {
+		authRequired := r.authRequired(http.MethodDelete, resource.DeleteAuthRequired())
+		route.Metadata(MetadataAuthRequired, authRequired)
+		if authRequired {
 			route.Returns(http.StatusUnauthorized, "Authorization required", ErrorResponse{})
-			route.Param(restful.QueryParameter("accesstoken", "accesstoken required for auth").
-				DataType("string").
-				Required(true).
-				AllowMultiple(false))
+			r.authParams(route)
 		}
 
 		for _, p := range resource.DeleteParams() {
@@ -261,27 +266,127 @@ func (r Resource) Init(container *restful.Container, resource interface{}) {
 			Required(true).
 			AllowMultiple(false))
 
-		ws.Route(route)
+		r.addRoute(ws, http.MethodDelete, route)
 	}
 
 	container.Add(ws)
 }
 
+// logger returns the Logger of the Server this Resource is registered with
+func (r Resource) logger() Logger {
+	if r.Server != nil {
+		return r.Server.Config.logger()
+	}
+	return r.Config.logger()
+}
+
+// addRoute installs the per-route filters for method and adds route to ws
+func (r Resource) addRoute(ws *restful.WebService, method string, route *restful.RouteBuilder) {
+	if r.limiter != nil {
+		route.Filter(r.limiter.filter).
+			Returns(http.StatusServiceUnavailable, "Server is overloaded", ErrorResponse{})
+	}
+	if timeout := r.timeout(method); timeout > 0 {
+		route.Filter(timeoutFilter(timeout)).
+			Returns(http.StatusServiceUnavailable, "Request timed out", ErrorResponse{})
+	}
+
+	r.scopeDocs(method, route)
+
+	if overrides := r.securityHeaderOverrides(); len(overrides) > 0 {
+		route.Filter(securityHeadersFilter(overrides))
+	}
+
+	if limit, _ := r.rateLimitFor(method); limit.enabled() {
+		route.Returns(http.StatusTooManyRequests, "Rate limit exceeded", ErrorResponse{})
+	}
+
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		limit := r.maxBodySize()
+		route.Filter(bodyFilter(limit)).
+			Returns(http.StatusUnsupportedMediaType, "Unsupported content encoding", ErrorResponse{})
+		if limit > 0 {
+			route.Returns(http.StatusRequestEntityTooLarge, "Request body too large", ErrorResponse{})
+		}
+	}
+
+	ws.Route(route)
+
+	if r.Server != nil {
+		routes := ws.Routes()
+		r.Server.registerRoute(r, routes[len(routes)-1])
+	}
+}
+
+// newAPIContext creates a new APIContext for request
+func (r Resource) newAPIContext(request *restful.Request) APIContext {
+	context := r.Context.NewAPIContext()
+	if c, ok := context.(RequestIDSetter); ok {
+		c.SetRequestID(RequestID(request))
+	}
+	if c, ok := context.(RequestContextSetter); ok {
+		c.SetRequestContext(request.Request.Context())
+	}
+	if c, ok := context.(SpanSetter); ok {
+		if span := SpanFromRequest(request); span != nil {
+			c.SetSpan(span)
+		}
+	}
+	if c, ok := context.(ClientCertificateSetter); ok {
+		if cert := ClientCertificate(request); cert != nil {
+			c.SetClientCertificate(cert)
+		}
+	}
+
+	return context
+}
+
+// authenticate creates the APIContext for request and authenticates its user.
+// It responds with an error and returns false if the request must not be
+// processed any further.
+func (r Resource) authenticate(request *restful.Request, response *restful.Response, method string, authRequired bool) (APIContext, bool) {
+	request.SetAttribute(authConfigAttribute, r.Config.Auth)
+	context := r.newAPIContext(request)
+	auth, err := context.Authentication(request)
+
+	var principal interface{}
+	if err == nil {
+		principal = auth
+	}
+	if !r.rateLimit(request, response, method, principal) {
+		return nil, false
+	}
+
+	if r.authRequired(method, authRequired) {
+		if err != nil || auth == nil {
+			response.Header().Set("WWW-Authenticate", "Bearer")
+			ErrorResponseHandler(request, response, err, NewErrorResponse(
+				http.StatusUnauthorized,
+				"Invalid accesstoken",
+				method))
+			return nil, false
+		}
+		if !r.authorize(request, response, method, auth) {
+			return nil, false
+		}
+	}
+	context.SetAuth(auth)
+	request.SetAttribute(authAttribute, principal)
+	if principal != nil {
+		r.setCacheControl(response)
+	}
+
+	return context, true
+}
+
 // Get responds to GET requests
 func (r Resource) Get(request *restful.Request, response *restful.Response) {
 	if resource, ok := r.Parent.(GetSupported); ok {
-		context := r.Context.NewAPIContext()
-		auth, err := context.Authentication(request)
-		if resource.GetAuthRequired() {
-			if err != nil || auth == nil {
-				ErrorResponseHandler(request, response, err, NewErrorResponse(
-					http.StatusUnauthorized,
-					"Invalid accesstoken",
-					"GET"))
-				return
-			}
+		context, ok := r.authenticate(request, response, "GET", resource.GetAuthRequired())
+		if !ok {
+			return
 		}
-		context.SetAuth(auth)
 
 		params, err := Validate(request, resource.GetParams())
 		if err != nil {
@@ -308,27 +413,16 @@ func (r Resource) Get(request *restful.Request, response *restful.Response) {
 // Post responds to POST requests
 func (r Resource) Post(request *restful.Request, response *restful.Response) {
 	if resource, ok := r.Parent.(PostSupported); ok {
-		context := r.Context.NewAPIContext()
-		auth, err := context.Authentication(request)
-		if resource.PostAuthRequired() {
-			if err != nil || auth == nil {
-				ErrorResponseHandler(request, response, err, NewErrorResponse(
-					http.StatusUnauthorized,
-					"Invalid accesstoken",
-					"POST"))
-				return
-			}
+		context, ok := r.authenticate(request, response, "POST", resource.PostAuthRequired())
+		if !ok {
+			return
 		}
-		context.SetAuth(auth)
 
 		ps := resource.Reads()
 		if ps != nil {
 			err := request.ReadEntity(&ps)
 			if err != nil {
-				ErrorResponseHandler(request, response, err, NewErrorResponse(
-					http.StatusBadRequest,
-					"Can't parse request data",
-					"POST Data Validation"))
+				bodyReadError(request, response, err, "POST")
 				return
 			}
 
@@ -350,27 +444,16 @@ func (r Resource) Post(request *restful.Request, response *restful.Response) {
 // Put responds to PUT requests
 func (r Resource) Put(request *restful.Request, response *restful.Response) {
 	if resource, ok := r.Parent.(PutSupported); ok {
-		context := r.Context.NewAPIContext()
-		auth, err := context.Authentication(request)
-		if resource.PutAuthRequired() {
-			if err != nil || auth == nil {
-				ErrorResponseHandler(request, response, err, NewErrorResponse(
-					http.StatusUnauthorized,
-					"Invalid accesstoken",
-					"PUT"))
-				return
-			}
+		context, ok := r.authenticate(request, response, "PUT", resource.PutAuthRequired())
+		if !ok {
+			return
 		}
-		context.SetAuth(auth)
 
 		ps := resource.Reads()
 		if ps != nil {
 			err := request.ReadEntity(&ps)
 			if err != nil {
-				ErrorResponseHandler(request, response, err, NewErrorResponse(
-					http.StatusBadRequest,
-					"Can't parse request data",
-					"PUT Data Validation"))
+				bodyReadError(request, response, err, "PUT")
 				return
 			}
 
@@ -392,27 +475,16 @@ func (r Resource) Put(request *restful.Request, response *restful.Response) {
 // Patch responds to PATCH requests
 func (r Resource) Patch(request *restful.Request, response *restful.Response) {
 	if resource, ok := r.Parent.(PatchSupported); ok {
-		context := r.Context.NewAPIContext()
-		auth, err := context.Authentication(request)
-		if resource.PatchAuthRequired() {
-			if err != nil || auth == nil {
-				ErrorResponseHandler(request, response, err, NewErrorResponse(
-					http.StatusUnauthorized,
-					"Invalid accesstoken",
-					"PATCH"))
-				return
-			}
+		context, ok := r.authenticate(request, response, "PATCH", resource.PatchAuthRequired())
+		if !ok {
+			return
 		}
-		context.SetAuth(auth)
 
 		ps := resource.Reads()
 		if ps != nil {
 			err := request.ReadEntity(&ps)
 			if err != nil {
-				ErrorResponseHandler(request, response, err, NewErrorResponse(
-					http.StatusBadRequest,
-					"Can't parse request data",
-					"PATCH Data Validation"))
+				bodyReadError(request, response, err, "PATCH")
 				return
 			}
 
@@ -434,18 +506,10 @@ func (r Resource) Patch(request *restful.Request, response *restful.Response) {
 // Delete responds to DELETE requests
 func (r Resource) Delete(request *restful.Request, response *restful.Response) {
 	if resource, ok := r.Parent.(DeleteSupported); ok {
-		context := r.Context.NewAPIContext()
-		auth, err := context.Authentication(request)
-		if resource.DeleteAuthRequired() {
-			if err != nil || auth == nil {
-				ErrorResponseHandler(request, response, err, NewErrorResponse(
-					http.StatusUnauthorized,
-					"Invalid accesstoken",
-					"DELETE"))
-				return
-			}
+		context, ok := r.authenticate(request, response, "DELETE", resource.DeleteAuthRequired())
+		if !ok {
+			return
 		}
-		context.SetAuth(auth)
 
 		resource.Delete(context, request, response)
 		request.SetAttribute("context", context)
@@ -455,18 +519,10 @@ func (r Resource) Delete(request *restful.Request, response *restful.Response) {
 // GetByIDs handles GET requests which want to retrieve one or more IDs
 func (r Resource) GetByIDs(request *restful.Request, response *restful.Response) {
 	if resource, ok := r.Parent.(GetIDSupported); ok {
-		context := r.Context.NewAPIContext()
-		auth, err := context.Authentication(request)
-		if resource.GetByIDsAuthRequired() {
-			if err != nil || auth == nil {
-				ErrorResponseHandler(request, response, err, NewErrorResponse(
-					http.StatusUnauthorized,
-					"Invalid accesstoken",
-					"GET"))
-				return
-			}
+		context, ok := r.authenticate(request, response, "GET", resource.GetByIDsAuthRequired())
+		if !ok {
+			return
 		}
-		context.SetAuth(auth)
 
 		ids := []string{}
 		if ql, ok := request.Request.URL.Query()["ids[]"]; ok {
@@ -0,0 +1,211 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+)
+
+const defaultRoutesPath = "routes"
+
+const (
+	// MetadataAuthRequired is the key of the route metadata telling whether a
+	// route requires authentication
+	MetadataAuthRequired = "smolder.authRequired"
+	// MetadataScopes is the key of the route metadata listing the scopes a
+	// route requires
+	MetadataScopes = "smolder.scopes"
+)
+
+var parameterKinds = map[int]string{
+	restful.PathParameterKind:   "path",
+	restful.QueryParameterKind:  "query",
+	restful.BodyParameterKind:   "body",
+	restful.HeaderParameterKind: "header",
+	restful.FormParameterKind:   "form",
+}
+
+// RoutesConfig contains the parameters for the route listing admin endpoint
+type RoutesConfig struct {
+	// Endpoint registers an admin endpoint listing all Resources and their
+	// routes
+	Endpoint bool
+	// Path of the admin endpoint, defaults to "routes"
+	Path string
+	// Context authenticates the admin endpoint's requests, which are
+	// rejected unless Authentication returns a non-nil user
+	Context APIContextFactory `json:"-"`
+}
+
+// ResourceInfo describes a Resource registered with a Server
+type ResourceInfo struct {
+	Name     string      `json:"name"`
+	TypeName string      `json:"typeName"`
+	Endpoint string      `json:"endpoint"`
+	Doc      string      `json:"doc,omitempty"`
+	Routes   []RouteInfo `json:"routes"`
+}
+
+// RouteInfo describes a route of a Resource
+type RouteInfo struct {
+	Method       string      `json:"method"`
+	Path         string      `json:"path"`
+	Doc          string      `json:"doc,omitempty"`
+	AuthRequired bool        `json:"authRequired"`
+	Scopes       []string    `json:"scopes,omitempty"`
+	Params       []ParamInfo `json:"params,omitempty"`
+	// Reads and Returns are the Go types of the request and response bodies
+	Reads   string `json:"reads,omitempty"`
+	Returns string `json:"returns,omitempty"`
+}
+
+// ParamInfo describes a parameter of a route
+type ParamInfo struct {
+	Name          string `json:"name"`
+	Kind          string `json:"kind"`
+	DataType      string `json:"dataType,omitempty"`
+	Description   string `json:"description,omitempty"`
+	Required      bool   `json:"required"`
+	AllowMultiple bool   `json:"allowMultiple"`
+}
+
+// Resources returns all Resources registered with the Server, in the order
+// they were registered
+func (s *Server) Resources() []ResourceInfo {
+	s.routesMu.RLock()
+	defer s.routesMu.RUnlock()
+
+	resources := make([]ResourceInfo, 0, len(s.resources))
+	for _, res := range s.resources {
+		info := *res
+		info.Routes = append([]RouteInfo(nil), res.Routes...)
+		resources = append(resources, info)
+	}
+	return resources
+}
+
+// Resource returns the registered Resource called name
+func (s *Server) Resource(name string) (ResourceInfo, bool) {
+	for _, res := range s.Resources() {
+		if res.Name == name {
+			return res, true
+		}
+	}
+	return ResourceInfo{}, false
+}
+
+// registerRoute records a route added by Resource r
+func (s *Server) registerRoute(r Resource, route restful.Route) {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	s.resourceNames[route.Method+" "+route.Path] = r.Name
+
+	var res *ResourceInfo
+	for _, v := range s.resources {
+		if v.Name == r.Name {
+			res = v
+			break
+		}
+	}
+	if res == nil {
+		res = &ResourceInfo{
+			Name:     r.Name,
+			TypeName: r.TypeName,
+			Endpoint: r.Endpoint,
+			Doc:      r.Doc,
+		}
+		s.resources = append(s.resources, res)
+	}
+
+	res.Routes = append(res.Routes, routeInfo(route))
+}
+
+// resourceName returns the name of the Resource handling method on path
+func (s *Server) resourceName(method, path string) string {
+	s.routesMu.RLock()
+	defer s.routesMu.RUnlock()
+
+	return s.resourceNames[method+" "+path]
+}
+
+func routeInfo(route restful.Route) RouteInfo {
+	path := route.Path
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	info := RouteInfo{
+		Method: route.Method,
+		Path:   path,
+		Doc:    route.Doc,
+		Reads:  typeName(route.ReadSample),
+	}
+	if auth, ok := route.Metadata[MetadataAuthRequired].(bool); ok {
+		info.AuthRequired = auth
+	}
+	if scopes, ok := route.Metadata[MetadataScopes].([]string); ok {
+		info.Scopes = scopes
+	}
+	if ok, found := route.ResponseErrors[http.StatusOK]; found {
+		info.Returns = typeName(ok.Model)
+	}
+
+	for _, p := range route.ParameterDocs {
+		data := p.Data()
+		info.Params = append(info.Params, ParamInfo{
+			Name:          data.Name,
+			Kind:          parameterKinds[data.Kind],
+			DataType:      data.DataType,
+			Description:   data.Description,
+			Required:      data.Required,
+			AllowMultiple: data.AllowMultiple,
+		})
+	}
+
+	return info
+}
+
+// typeName returns the name of v's type, or an empty string if v is nil
+func typeName(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return reflect.TypeOf(v).String()
+}
+
+func (s *Server) registerRoutes() {
+	path := s.Config.Routes.Path
+	if path == "" {
+		path = defaultRoutesPath
+	}
+
+	ws := new(restful.WebService)
+	ws.Path("/" + s.Config.PathPrefix + path).
+		Doc("Registered resources and their routes").
+		Produces(restful.MIME_JSON)
+
+	ws.Route(ws.GET("").To(s.listRoutes).
+		Doc("list all resources and their routes").
+		Returns(http.StatusOK, "OK", []ResourceInfo{}).
+		Returns(http.StatusUnauthorized, "Authorization required", ErrorResponse{}))
+
+	s.Container.Add(ws)
+}
+
+func (s *Server) listRoutes(request *restful.Request, response *restful.Response) {
+	if !s.authenticateAdmin(request, response, s.Config.Routes.Context) {
+		return
+	}
+
+	response.WriteEntity(s.Resources())
+}
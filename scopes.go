@@ -0,0 +1,140 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+)
+
+// ErrInsufficientScope is the error of requests rejected because their
+// principal lacks a required scope
+var ErrInsufficientScope = errors.New("Insufficient scope")
+
+// ScopedPrincipal can be implemented by the principals returned from
+// APIContext.Authentication to grant them scopes. Roles can be granted the
+// same way, a Resource then requires the role's name as a scope.
+type ScopedPrincipal interface {
+	Scopes() []string
+}
+
+// GetScopesSupported can be implemented by Resources to require scopes for
+// GET requests
+type GetScopesSupported interface {
+	GetScopes() []string
+}
+
+// PostScopesSupported can be implemented by Resources to require scopes for
+// POST requests
+type PostScopesSupported interface {
+	PostScopes() []string
+}
+
+// PutScopesSupported can be implemented by Resources to require scopes for
+// PUT requests
+type PutScopesSupported interface {
+	PutScopes() []string
+}
+
+// PatchScopesSupported can be implemented by Resources to require scopes for
+// PATCH requests
+type PatchScopesSupported interface {
+	PatchScopes() []string
+}
+
+// DeleteScopesSupported can be implemented by Resources to require scopes
+// for DELETE requests
+type DeleteScopesSupported interface {
+	DeleteScopes() []string
+}
+
+// ScopesSupported can be implemented by Resources to require scopes for all
+// methods without per-method scopes
+type ScopesSupported interface {
+	Scopes() []string
+}
+
+// scopes returns the scopes required for method, preferring per-method over
+// resource-wide scopes. Requests must be authenticated by a principal holding
+// all of them.
+func (r Resource) scopes(method string) []string {
+	var s []string
+	switch method {
+	case http.MethodGet:
+		if res, ok := r.Parent.(GetScopesSupported); ok {
+			s = res.GetScopes()
+		}
+	case http.MethodPost:
+		if res, ok := r.Parent.(PostScopesSupported); ok {
+			s = res.PostScopes()
+		}
+	case http.MethodPut:
+		if res, ok := r.Parent.(PutScopesSupported); ok {
+			s = res.PutScopes()
+		}
+	case http.MethodPatch:
+		if res, ok := r.Parent.(PatchScopesSupported); ok {
+			s = res.PatchScopes()
+		}
+	case http.MethodDelete:
+		if res, ok := r.Parent.(DeleteScopesSupported); ok {
+			s = res.DeleteScopes()
+		}
+	}
+	if len(s) > 0 {
+		return s
+	}
+
+	if res, ok := r.Parent.(ScopesSupported); ok {
+		return res.Scopes()
+	}
+	return nil
+}
+
+// authRequired tells whether method requires authentication. Requiring
+// scopes implies it.
+func (r Resource) authRequired(method string, required bool) bool {
+	return required || len(r.scopes(method)) > 0
+}
+
+// authorize responds with a 403 and returns false unless principal holds
+// all scopes required for method
+func (r Resource) authorize(request *restful.Request, response *restful.Response, method string, principal interface{}) bool {
+	required := r.scopes(method)
+	if len(required) == 0 {
+		return true
+	}
+
+	var granted []string
+	if p, ok := principal.(ScopedPrincipal); ok {
+		granted = p.Scopes()
+	}
+	for _, scope := range required {
+		if !containsString(granted, scope) {
+			response.Header().Set("WWW-Authenticate",
+				`Bearer error="insufficient_scope", scope="`+strings.Join(required, " ")+`"`)
+			ErrorResponseHandler(request, response, ErrInsufficientScope, NewErrorResponse(
+				http.StatusForbidden,
+				"Missing scope "+scope,
+				method))
+			return false
+		}
+	}
+	return true
+}
+
+// scopeDocs documents the scopes required for method on route
+func (r Resource) scopeDocs(method string, route *restful.RouteBuilder) {
+	if scopes := r.scopes(method); len(scopes) > 0 {
+		route.Metadata(MetadataScopes, scopes).
+			Returns(http.StatusForbidden, "Insufficient scope", ErrorResponse{})
+	}
+}
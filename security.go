@@ -0,0 +1,151 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+const (
+	defaultHSTSMaxAge            = 365 * 24 * time.Hour
+	defaultReferrerPolicy        = "no-referrer"
+	defaultContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+	defaultCacheControl          = "no-store"
+
+	headerCacheControl = "Cache-Control"
+)
+
+// SecurityHeadersConfig contains the security related headers added to every
+// response. The defaults are suitable for JSON APIs that are never rendered
+// by browsers.
+type SecurityHeadersConfig struct {
+	// Enabled adds the security headers to all responses
+	Enabled bool
+	// HSTSMaxAge defaults to one year, a negative value omits
+	// Strict-Transport-Security
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	// ReferrerPolicy defaults to "no-referrer"
+	ReferrerPolicy string
+	// ContentSecurityPolicy defaults to
+	// "default-src 'none'; frame-ancestors 'none'"
+	ContentSecurityPolicy string
+	// CacheControl is set on responses to authenticated requests, unless
+	// the handler sets its own. Defaults to "no-store".
+	CacheControl string
+}
+
+// SecurityHeaders maps header names to the values overriding the configured
+// security headers. An empty value removes the header.
+type SecurityHeaders map[string]string
+
+// SecurityHeadersSupported can be implemented by Resources to override the
+// security headers configured in APIConfig. The overrides only apply while
+// SecurityHeadersConfig is enabled.
+type SecurityHeadersSupported interface {
+	SecurityHeaders() SecurityHeaders
+}
+
+// headers returns the security headers added to every response
+func (c SecurityHeadersConfig) headers() SecurityHeaders {
+	h := SecurityHeaders{
+		"X-Content-Type-Options":  "nosniff",
+		"Referrer-Policy":         c.ReferrerPolicy,
+		"Content-Security-Policy": c.ContentSecurityPolicy,
+	}
+	if h["Referrer-Policy"] == "" {
+		h["Referrer-Policy"] = defaultReferrerPolicy
+	}
+	if h["Content-Security-Policy"] == "" {
+		h["Content-Security-Policy"] = defaultContentSecurityPolicy
+	}
+
+	maxAge := c.HSTSMaxAge
+	if maxAge == 0 {
+		maxAge = defaultHSTSMaxAge
+	}
+	if maxAge > 0 {
+		hsts := "max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)
+		if c.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if c.HSTSPreload {
+			hsts += "; preload"
+		}
+		h["Strict-Transport-Security"] = hsts
+	}
+
+	return h
+}
+
+// apply sets the headers on header, removing those with an empty value
+func (h SecurityHeaders) apply(header http.Header) {
+	for k, v := range h {
+		if v == "" {
+			header.Del(k)
+			continue
+		}
+		header.Set(k, v)
+	}
+}
+
+func (s *Server) securityHeadersFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	s.securityHeaders.apply(response.Header())
+
+	chain.ProcessFilter(request, response)
+}
+
+// securityHeadersFilter applies a Resource's overrides of the configured
+// security headers
+func securityHeadersFilter(overrides SecurityHeaders) restful.FilterFunction {
+	return func(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+		overrides.apply(response.Header())
+
+		chain.ProcessFilter(request, response)
+	}
+}
+
+// securityHeaderOverrides returns the Resource's security header overrides,
+// unless security headers are disabled
+func (r Resource) securityHeaderOverrides() SecurityHeaders {
+	if !r.Config.SecurityHeaders.Enabled {
+		return nil
+	}
+	if res, ok := r.Parent.(SecurityHeadersSupported); ok {
+		return res.SecurityHeaders()
+	}
+	return nil
+}
+
+// setCacheControl marks the response to an authenticated request as private,
+// unless the Resource overrides Cache-Control
+func (r Resource) setCacheControl(response *restful.Response) {
+	if !r.Config.SecurityHeaders.Enabled {
+		return
+	}
+	for k := range r.securityHeaderOverrides() {
+		if http.CanonicalHeaderKey(k) == headerCacheControl {
+			// already applied by securityHeadersFilter
+			return
+		}
+	}
+	if response.Header().Get(headerCacheControl) != "" {
+		return
+	}
+
+	cacheControl := r.Config.SecurityHeaders.CacheControl
+	if cacheControl == "" {
+		cacheControl = defaultCacheControl
+	}
+	response.Header().Set(headerCacheControl, cacheControl)
+}
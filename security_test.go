@@ -0,0 +1,90 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"net/http"
+	"testing"
+)
+
+// framedResource allows framing and adds its own header
+type framedResource struct {
+	testResource
+}
+
+func (r *framedResource) SecurityHeaders() SecurityHeaders {
+	return SecurityHeaders{
+		"Content-Security-Policy": "",
+		"X-Frame-Options":         "SAMEORIGIN",
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		path    string
+		headers map[string]string
+	}{
+		{
+			name:    "enabled",
+			enabled: true,
+			path:    "/test",
+			headers: map[string]string{
+				"X-Content-Type-Options":  "nosniff",
+				"Content-Security-Policy": defaultContentSecurityPolicy,
+				"X-Frame-Options":         "",
+			},
+		},
+		{
+			name:    "enabled with overrides",
+			enabled: true,
+			path:    "/framed",
+			headers: map[string]string{
+				"X-Content-Type-Options":  "nosniff",
+				"Content-Security-Policy": "",
+				"X-Frame-Options":         "SAMEORIGIN",
+			},
+		},
+		{
+			name: "disabled",
+			path: "/test",
+			headers: map[string]string{
+				"X-Content-Type-Options":  "",
+				"Content-Security-Policy": "",
+			},
+		},
+		{
+			name: "disabled with overrides",
+			path: "/framed",
+			headers: map[string]string{
+				"X-Content-Type-Options":  "",
+				"Content-Security-Policy": "",
+				"X-Frame-Options":         "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(APIConfig{SecurityHeaders: SecurityHeadersConfig{Enabled: tt.enabled}})
+			r := &framedResource{}
+			register(s, &r.Resource, r, "framed")
+
+			rec := serve(s, http.MethodGet, tt.path, nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d", rec.Code)
+			}
+			for k, v := range tt.headers {
+				if got := rec.Header().Get(k); got != v {
+					t.Errorf("%s = %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
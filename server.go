@@ -0,0 +1,308 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+// Server owns a Container together with its in-flight request counter and
+// its shutdown state. Multiple Servers can safely live in the same process.
+type Server struct {
+	Container *restful.Container
+	Config    APIConfig
+
+	mu           sync.Mutex
+	shuttingDown bool
+	pending      int
+	drained      chan struct{}
+	freed        chan struct{}
+	httpServers  []*http.Server
+
+	healthPaths     map[string]bool
+	rateLimitStore  RateLimitStore
+	metrics         *metrics
+	securityHeaders SecurityHeaders
+
+	routesMu      sync.RWMutex
+	resourceNames map[string]string
+	resources     []*ResourceInfo
+
+	maintenanceMu sync.RWMutex
+	maintenance   map[string]Maintenance
+
+	// legacy shutdown signalling as passed to NewSmolderContainer
+	shutdownGracefully *bool
+	requestIncChan     chan int
+}
+
+// NewServer initializes a new Server with a Container and all the default filters
+func NewServer(config APIConfig) *Server {
+	s := &Server{
+		Config:         config,
+		rateLimitStore: config.RateLimit.Store,
+		resourceNames:  make(map[string]string),
+		maintenance:    make(map[string]Maintenance),
+	}
+	if s.rateLimitStore == nil {
+		s.rateLimitStore = NewMemoryRateLimitStore()
+	}
+
+	// go-restful only supports a single, package-wide logger
+	restful.SetLogger(restfulLogger{logger: config.logger()})
+
+	s.Container = restful.NewContainer()
+	s.Container.ServiceErrorHandler(s.serviceErrorHandler)
+	s.Container.Filter(s.requestIDFilter)
+	// a panic in any of the following filters must not take down the
+	// connection
+	s.Container.Filter(s.recoveryFilter)
+	if config.SecurityHeaders.Enabled {
+		s.securityHeaders = config.SecurityHeaders.headers()
+		s.Container.Filter(s.securityHeadersFilter)
+	}
+	if config.Tracing.Enabled {
+		s.Container.Filter(s.tracingFilter)
+	}
+	if config.Metrics.Enabled {
+		s.metrics = newMetrics(config.Metrics)
+		s.Container.Filter(s.metricsFilter)
+	}
+	// log requests rejected during shutdown, too
+	s.Container.Filter(s.loggingFilter)
+	s.Container.Filter(s.gracefulShutdownFilter)
+	if config.Compression.Enabled {
+		s.Container.Filter(s.compressionFilter)
+	}
+	// recover from panics of handlers once more, so their 500s still show up in
+	// the access log and metrics
+	s.Container.Filter(s.recoveryFilter)
+	s.Container.Filter(s.optionsFilter)
+	s.Container.Filter(s.corsFilter)
+	s.Container.Filter(s.maintenanceFilter)
+
+	if config.Health.Enabled {
+		s.registerHealth()
+	}
+	if config.Metrics.Endpoint {
+		s.registerMetrics()
+	}
+	if config.Maintenance.Endpoint {
+		s.registerMaintenance()
+	}
+	if config.Routes.Endpoint {
+		s.registerRoutes()
+	}
+
+	return s
+}
+
+// ServeHTTP implements net/http.Handler, so a Server can be used as the
+// Handler of a http.Server
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Container.ServeHTTP(w, r)
+}
+
+// ShuttingDown returns true once the Server started shutting down
+func (s *Server) ShuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.isShuttingDown()
+}
+
+// PendingRequests returns the number of requests currently being processed
+func (s *Server) PendingRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pending
+}
+
+// ListenAndServe listens on the TCP address addr and serves the API, using
+// TLS if it's configured. It returns http.ErrServerClosed after Shutdown.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve validates the configuration, accepts connections on l and serves the
+// API, using TLS if it's configured. It returns http.ErrServerClosed after Shutdown.
+func (s *Server) Serve(l net.Listener) error {
+	if err := s.Config.Validate(); err != nil {
+		l.Close()
+		return err
+	}
+
+	srv := &http.Server{Handler: s}
+
+	var reloader *certReloader
+	if s.Config.TLS.enabled() {
+		var err error
+		reloader, err = newCertReloader(s.Config.TLS, s.Config.logger())
+		if err != nil {
+			l.Close()
+			return err
+		}
+
+		go reloader.watch()
+		defer reloader.stop()
+	}
+
+	s.mu.Lock()
+	if s.isShuttingDown() {
+		s.mu.Unlock()
+		l.Close()
+		return http.ErrServerClosed
+	}
+	s.httpServers = append(s.httpServers, srv)
+	s.mu.Unlock()
+
+	if reloader != nil {
+		srv.TLSConfig = reloader.baseConfig()
+		return srv.ServeTLS(l, "", "")
+	}
+	return srv.Serve(l)
+}
+
+// Shutdown makes the Server reject all new requests with a 503 and waits
+// until all pending requests have been processed, before it closes the
+// listeners started by ListenAndServe and Serve. If ctx expires before that,
+// the listeners and all connections are closed forcefully and Shutdown
+// returns the context's error.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.drain(ctx)
+
+	s.mu.Lock()
+	httpServers := s.httpServers
+	s.httpServers = nil
+	s.mu.Unlock()
+
+	for _, srv := range httpServers {
+		if err == nil {
+			if err = srv.Shutdown(ctx); err == nil {
+				continue
+			}
+		}
+		// the deadline passed, don't wait for the remaining connections
+		srv.Close()
+	}
+	return err
+}
+
+// drain rejects all new requests and waits for the pending ones to finish
+func (s *Server) drain(ctx context.Context) error {
+	s.mu.Lock()
+	s.shuttingDown = true
+	if s.freed != nil {
+		// wake up the queued requests, so they get rejected right away
+		close(s.freed)
+		s.freed = nil
+	}
+	if s.pending == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	if s.drained == nil {
+		s.drained = make(chan struct{})
+	}
+	drained := s.drained
+	s.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isShuttingDown must be called with s.mu held
+func (s *Server) isShuttingDown() bool {
+	return s.shuttingDown || (s.shutdownGracefully != nil && *s.shutdownGracefully)
+}
+
+// acquire registers a new in-flight request. When the concurrency limit is
+// reached, it waits for a free slot for up to the configured queue timeout.
+// It returns errShuttingDown or ErrOverloaded if the request must be rejected.
+func (s *Server) acquire(ctx context.Context) error {
+	var timeout <-chan time.Time
+
+	s.mu.Lock()
+	for {
+		if s.isShuttingDown() {
+			s.mu.Unlock()
+			return errShuttingDown
+		}
+
+		max := s.Config.Concurrency.MaxRequests
+		if max <= 0 || s.pending < max {
+			break
+		}
+
+		if timeout == nil {
+			if s.Config.Concurrency.QueueTimeout <= 0 {
+				s.mu.Unlock()
+				return ErrOverloaded
+			}
+			timer := time.NewTimer(s.Config.Concurrency.QueueTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		if s.freed == nil {
+			s.freed = make(chan struct{})
+		}
+		freed := s.freed
+		s.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-timeout:
+			return ErrOverloaded
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		s.mu.Lock()
+	}
+	s.pending++
+	s.mu.Unlock()
+
+	if s.requestIncChan != nil {
+		s.requestIncChan <- 1
+	}
+	return nil
+}
+
+// release marks an in-flight request as finished
+func (s *Server) release() {
+	s.mu.Lock()
+	s.pending--
+	if s.pending == 0 && s.drained != nil {
+		close(s.drained)
+		s.drained = nil
+	}
+	if s.freed != nil {
+		close(s.freed)
+		s.freed = nil
+	}
+	s.mu.Unlock()
+
+	if s.requestIncChan != nil {
+		s.requestIncChan <- -1
+	}
+}
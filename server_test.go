@@ -0,0 +1,95 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+// blockingResource answers GET requests once unblock is closed
+type blockingResource struct {
+	testResource
+	unblock chan struct{}
+}
+
+func (r *blockingResource) Get(context APIContext, request *restful.Request, response *restful.Response, params map[string][]string) {
+	<-r.unblock
+	response.WriteEntity("done")
+}
+
+// waitFor polls cond until it's true or a second passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	for i := 0; !cond(); i++ {
+		if i > 100 {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShutdownRejectsQueuedRequests(t *testing.T) {
+	s := newTestServer(APIConfig{Concurrency: ConcurrencyConfig{
+		MaxRequests:  1,
+		QueueTimeout: 10 * time.Second,
+	}})
+	r := &blockingResource{unblock: make(chan struct{})}
+	register(s, &r.Resource, r, "blocking")
+
+	codes := make(chan int, 2)
+	get := func() {
+		codes <- serve(s, http.MethodGet, "/blocking", nil).Code
+	}
+
+	// the first request takes the only slot, the second one queues up
+	go get()
+	waitFor(t, "the first request", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.pending == 1
+	})
+	go get()
+	waitFor(t, "the queued request", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.freed != nil
+	})
+
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	select {
+	case code := <-codes:
+		if code != http.StatusServiceUnavailable {
+			t.Errorf("got status %d for the queued request, want 503", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued request wasn't rejected on shutdown")
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d for a new request while shutting down, want 503", rec.Code)
+	}
+
+	close(r.unblock)
+	if code := <-codes; code != http.StatusOK {
+		t.Errorf("got status %d for the in-flight request, want 200", code)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown returned %v", err)
+	}
+}
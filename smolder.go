@@ -9,101 +9,53 @@ package smolder
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/emicklei/go-restful"
-	log "github.com/sirupsen/logrus"
 )
 
 const (
 	optionsReqIdentifier = "OPTIONS"
 )
 
-var (
-	shutdownGracefully *bool
-	requestIncChan     chan int
-)
+func (s *Server) gracefulShutdownFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	if s.isHealthRequest(request) {
+		// Health endpoints keep answering while shutting down, so they
+		// can report that we're no longer ready
+		chain.ProcessFilter(request, response)
+		return
+	}
 
-func gracefulShutdownFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
-	if shutdownGracefully != nil && *shutdownGracefully {
+	switch err := s.acquire(request.Request.Context()); err {
+	case nil:
+	case errShuttingDown:
 		var resp struct {
 			Error string `json:"error"`
 		}
 		resp.Error = "Server is shutting down"
 
-		log.Warn("Rejecting incoming request")
+		requestLogger(request).Warn("Rejecting incoming request")
 		response.WriteHeaderAndEntity(http.StatusServiceUnavailable, resp)
 		return
+	default:
+		// Too many requests are in-flight already
+		shed(request, response, s.Config.Concurrency.RetryAfter, err)
+		return
 	}
 
-	defer func() {
-		// Make sure pendingReqeusts gets decremented even if a panic was
-		// thrown in ProcessFilter().
-		if requestIncChan != nil {
-			requestIncChan <- -1
-		}
-	}()
-
-	if requestIncChan != nil {
-		requestIncChan <- 1
-	}
-	chain.ProcessFilter(request, response)
-}
-
-func loggingFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
-	start := time.Now()
-	if req.Request.Method != optionsReqIdentifier {
-		log.WithFields(log.Fields{
-			"Method": req.Request.Method,
-			"URL":    req.Request.URL.String(),
-		}).Info("Handling request")
-	}
-
-	resp.PrettyPrint(false)
-	chain.ProcessFilter(req, resp)
-	duration := time.Since(start)
-
-	if req.Request.Method != optionsReqIdentifier {
-		log.WithFields(log.Fields{
-			"Method":   req.Request.Method,
-			"URL":      req.Request.URL.String(),
-			"Response": resp.StatusCode(),
-			"Duration": duration,
-		}).Info("Finished request")
-	}
-}
-
-func corsFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
-	if request.Request.Method != optionsReqIdentifier {
-		response.Header().Set("Access-Control-Allow-Origin", "*")
-	}
-	chain.ProcessFilter(request, response)
-}
-
-func optionsFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
-	if request.Request.Method == optionsReqIdentifier {
-		response.AddHeader(restful.HEADER_AccessControlAllowHeaders, "authorization, content-type")
-		response.AddHeader(restful.HEADER_AccessControlAllowMethods, "GET, POST, PUT, PATCH, DELETE")
-	}
+	// Make sure pendingRequests gets decremented even if a panic was
+	// thrown in ProcessFilter().
+	defer s.release()
 
 	chain.ProcessFilter(request, response)
 }
 
-// NewSmolderContainer initializes a new Container with all the default filters
+// NewSmolderContainer initializes a new Container with all the default filters.
+// It is a shorthand for NewServer, optionally signalling shutdown state via
+// _shutdownGracefully and reporting in-flight requests to _requestIncChan.
 func NewSmolderContainer(config APIConfig, _shutdownGracefully *bool, _requestIncChan chan int) *restful.Container {
-	shutdownGracefully = _shutdownGracefully
-	requestIncChan = _requestIncChan
-
-	wsContainer := restful.NewContainer()
-	wsContainer.Filter(gracefulShutdownFilter)
-	wsContainer.Filter(loggingFilter)
-	wsContainer.Filter(optionsFilter)
-	wsContainer.Filter(corsFilter)
-	wsContainer.Filter(wsContainer.OPTIONSFilter)
-
-	return wsContainer
-}
+	s := NewServer(config)
+	s.shutdownGracefully = _shutdownGracefully
+	s.requestIncChan = _requestIncChan
 
-func init() {
-	restful.SetLogger(log.StandardLogger())
+	return s.Container
 }
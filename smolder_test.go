@@ -0,0 +1,150 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"net/http/httptest"
+	"sync"
+
+	"github.com/emicklei/go-restful"
+)
+
+// testContext authenticates requests with the token "valid"
+type testContext struct {
+	auth interface{}
+}
+
+func (c *testContext) NewAPIContext() APIContext {
+	return &testContext{}
+}
+
+func (c *testContext) Authentication(request *restful.Request) (interface{}, error) {
+	if AccessToken(request) == "valid" {
+		return "user", nil
+	}
+	return nil, nil
+}
+
+func (c *testContext) SetAuth(auth interface{}) {
+	c.auth = auth
+}
+
+// testResource responds to GET and DELETE requests
+type testResource struct {
+	Resource
+}
+
+func (r *testResource) Returns() interface{}               { return "" }
+func (r *testResource) GetAuthRequired() bool              { return false }
+func (r *testResource) GetDoc() string                     { return "get test" }
+func (r *testResource) GetParams() []*restful.Parameter    { return nil }
+func (r *testResource) DeleteAuthRequired() bool           { return false }
+func (r *testResource) DeleteDoc() string                  { return "delete test" }
+func (r *testResource) DeleteParams() []*restful.Parameter { return nil }
+
+func (r *testResource) Get(context APIContext, request *restful.Request, response *restful.Response, params map[string][]string) {
+	response.WriteEntity("get")
+}
+
+func (r *testResource) Delete(context APIContext, request *restful.Request, response *restful.Response) {
+	response.WriteEntity("delete")
+}
+
+// newTestServer creates a Server with config and a testResource on /test
+func newTestServer(config APIConfig) *Server {
+	if config.Logger == nil {
+		config.Logger = DiscardLogger()
+	}
+	s := NewServer(config)
+
+	r := &testResource{}
+	register(s, &r.Resource, r, "test")
+
+	return s
+}
+
+// register initializes res with the Server's config and registers parent on
+// /name
+func register(s *Server, res *Resource, parent interface{}, name string) {
+	res.Name = name
+	res.TypeName = name
+	res.Endpoint = name
+	res.Config = s.Config
+	res.Context = &testContext{}
+	res.Server = s
+	res.Init(s.Container, parent)
+}
+
+// recordingLogger keeps all log entries
+type recordingLogger struct {
+	mu      *sync.Mutex
+	entries *[]logEntry
+	fields  Fields
+}
+
+type logEntry struct {
+	msg    string
+	fields Fields
+}
+
+func newRecordingLogger() recordingLogger {
+	return recordingLogger{mu: &sync.Mutex{}, entries: &[]logEntry{}}
+}
+
+func (l recordingLogger) WithFields(fields Fields) Logger {
+	f := Fields{}
+	for k, v := range l.fields {
+		f[k] = v
+	}
+	for k, v := range fields {
+		f[k] = v
+	}
+	l.fields = f
+	return l
+}
+
+func (l recordingLogger) Debug(msg string) { l.record(msg) }
+func (l recordingLogger) Info(msg string)  { l.record(msg) }
+func (l recordingLogger) Warn(msg string)  { l.record(msg) }
+func (l recordingLogger) Error(msg string) { l.record(msg) }
+
+func (l recordingLogger) record(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*l.entries = append(*l.entries, logEntry{msg: msg, fields: l.fields})
+}
+
+// logged returns whether msg has been logged
+func (l recordingLogger) logged(msg string) bool {
+	_, ok := l.entry(msg)
+	return ok
+}
+
+// entry returns the fields of the first log entry with msg
+func (l recordingLogger) entry(msg string) (Fields, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range *l.entries {
+		if e.msg == msg {
+			return e.fields, true
+		}
+	}
+	return nil, false
+}
+
+// serve sends a request with headers to s and returns the recorded response
+func serve(s *Server, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,256 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+// GetTimeoutSupported can be implemented by Resources to override the request
+// timeout for GET requests
+type GetTimeoutSupported interface {
+	GetTimeout() time.Duration
+}
+
+// PostTimeoutSupported can be implemented by Resources to override the
+// request timeout for POST requests
+type PostTimeoutSupported interface {
+	PostTimeout() time.Duration
+}
+
+// PutTimeoutSupported can be implemented by Resources to override the request
+// timeout for PUT requests
+type PutTimeoutSupported interface {
+	PutTimeout() time.Duration
+}
+
+// PatchTimeoutSupported can be implemented by Resources to override the
+// request timeout for PATCH requests
+type PatchTimeoutSupported interface {
+	PatchTimeout() time.Duration
+}
+
+// DeleteTimeoutSupported can be implemented by Resources to override the
+// request timeout for DELETE requests
+type DeleteTimeoutSupported interface {
+	DeleteTimeout() time.Duration
+}
+
+// TimeoutSupported can be implemented by Resources to override the request
+// timeout for all of their methods
+type TimeoutSupported interface {
+	Timeout() time.Duration
+}
+
+// timeout returns the request timeout for method, preferring per-method over
+// per-resource overrides over the configured default
+func (r Resource) timeout(method string) time.Duration {
+	var t time.Duration
+	switch method {
+	case http.MethodGet:
+		if res, ok := r.Parent.(GetTimeoutSupported); ok {
+			t = res.GetTimeout()
+		}
+	case http.MethodPost:
+		if res, ok := r.Parent.(PostTimeoutSupported); ok {
+			t = res.PostTimeout()
+		}
+	case http.MethodPut:
+		if res, ok := r.Parent.(PutTimeoutSupported); ok {
+			t = res.PutTimeout()
+		}
+	case http.MethodPatch:
+		if res, ok := r.Parent.(PatchTimeoutSupported); ok {
+			t = res.PatchTimeout()
+		}
+	case http.MethodDelete:
+		if res, ok := r.Parent.(DeleteTimeoutSupported); ok {
+			t = res.DeleteTimeout()
+		}
+	}
+	if t > 0 {
+		return t
+	}
+
+	if res, ok := r.Parent.(TimeoutSupported); ok && res.Timeout() > 0 {
+		return res.Timeout()
+	}
+	return r.Config.Timeout
+}
+
+// timeoutFilter cancels the request's context after timeout and answers with
+// a 503 ErrorResponse, even if the handler doesn't honor its context
+func timeoutFilter(timeout time.Duration) restful.FilterFunction {
+	return func(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+		ctx, cancel := context.WithTimeout(request.Request.Context(), timeout)
+		defer cancel()
+		request.Request = request.Request.WithContext(ctx)
+		id := RequestID(request)
+		logger := requestLogger(request)
+
+		// The handler writes into a buffer, so we can still respond with an
+		// error once the deadline passed
+		tw := &timeoutWriter{
+			header: make(http.Header),
+		}
+		for k, v := range response.Header() {
+			tw.header[k] = append([]string(nil), v...)
+		}
+		inner := *response
+		inner.ResponseWriter = tw
+
+		done := make(chan struct{})
+		panicc := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicc <- p
+				}
+				close(done)
+			}()
+
+			chain.ProcessFilter(request, &inner)
+		}()
+		// repanic hands a panic of the handler to the recovery filter
+		repanic := func() {
+			select {
+			case p := <-panicc:
+				panic(p)
+			default:
+			}
+		}
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if ctx.Err() != context.DeadlineExceeded {
+				// The client went away, there's nobody left to answer
+				<-done
+				break
+			}
+
+			tw.mu.Lock()
+			tw.timedOut = true
+			tw.mu.Unlock()
+
+			logger.WithFields(Fields{
+				"Method":  request.Request.Method,
+				"URL":     redactAccessToken(request.Request.URL.String()),
+				"Timeout": timeout,
+			}).Warn("Request timed out")
+
+			err := NewErrorResponse(
+				http.StatusServiceUnavailable,
+				"Request timed out",
+				request.Request.Method)
+			err.Err[0].RequestID = id
+
+			writeTimeoutResponse(response, err, logger)
+
+			// Keep the request in-flight until the handler actually
+			// returned, so shutdown and concurrency accounting stay accurate
+			<-done
+			repanic()
+			return
+		}
+
+		repanic()
+
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.flushTo(response)
+	}
+}
+
+// writeTimeoutResponse sends err as a complete response with a Content-Length,
+// so the client doesn't have to wait for the handler to return
+func writeTimeoutResponse(response *restful.Response, err *ErrorResponse, logger Logger) {
+	body, jerr := json.Marshal(err)
+	if jerr != nil {
+		logger.WithFields(Fields{"Error": jerr}).Error("Can't encode timeout response")
+		response.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	response.Header().Set(restful.HEADER_ContentType, restful.MIME_JSON)
+	response.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	response.WriteHeader(http.StatusServiceUnavailable)
+	response.Write(body)
+	response.Flush()
+}
+
+// timeoutWriter buffers a handler's response until it either completed or
+// timed out
+type timeoutWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeader(code)
+}
+
+func (tw *timeoutWriter) writeHeader(code int) {
+	tw.wroteHeader = true
+	tw.code = code
+}
+
+// flushTo copies the buffered response, must be called with tw.mu held
+func (tw *timeoutWriter) flushTo(response *restful.Response) {
+	dst := response.Header()
+	for k := range dst {
+		if _, ok := tw.header[k]; !ok {
+			dst.Del(k)
+		}
+	}
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+
+	if tw.wroteHeader {
+		response.WriteHeader(tw.code)
+	}
+	if tw.buf.Len() > 0 {
+		response.Write(tw.buf.Bytes())
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+// slowResource ignores its context and takes 300ms to answer GET requests
+type slowResource struct {
+	testResource
+}
+
+func (r *slowResource) Get(context APIContext, request *restful.Request, response *restful.Response, params map[string][]string) {
+	time.Sleep(300 * time.Millisecond)
+	response.WriteEntity("slow")
+}
+
+func newSlowServer(timeout time.Duration, logger Logger) *Server {
+	s := newTestServer(APIConfig{Timeout: timeout, Logger: logger})
+	r := &slowResource{}
+	register(s, &r.Resource, r, "slow")
+	return s
+}
+
+func TestTimeout(t *testing.T) {
+	logger := newRecordingLogger()
+	ts := httptest.NewServer(newSlowServer(50*time.Millisecond, logger))
+	defer ts.Close()
+
+	for _, encoding := range []string{"", "gzip"} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/slow", nil)
+		// the server only reads the next request on a connection once the
+		// previous handler returned
+		req.Close = true
+		if encoding != "" {
+			req.Header.Set("Accept-Encoding", encoding)
+		}
+
+		start := time.Now()
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		elapsed := time.Since(start)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("got status %d, want 503", resp.StatusCode)
+		}
+		if elapsed >= 200*time.Millisecond {
+			t.Errorf("response with Accept-Encoding %q completed after %v, want it before the handler returns", encoding, elapsed)
+		}
+		if resp.ContentLength != int64(len(body)) {
+			t.Errorf("got Content-Length %d for a %d byte body", resp.ContentLength, len(body))
+		}
+
+		var e ErrorResponse
+		if err := json.Unmarshal(body, &e); err != nil || len(e.Err) == 0 || e.Err[0].Msg != "Request timed out" {
+			t.Errorf("got body %q, %v", body, err)
+		}
+	}
+
+	if !logger.logged("Request timed out") {
+		t.Error("timeout wasn't logged")
+	}
+
+	// requests completing in time aren't affected
+	if code := serve(newSlowServer(time.Second, DiscardLogger()), http.MethodGet, "/slow", nil).Code; code != http.StatusOK {
+		t.Errorf("got status %d for a request within its timeout", code)
+	}
+}
+
+func TestTimeoutClientGone(t *testing.T) {
+	logger := newRecordingLogger()
+	s := newSlowServer(time.Second, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil).WithContext(ctx))
+
+	if rec.Code == http.StatusServiceUnavailable {
+		t.Error("got a 503 for a client that went away")
+	}
+	if logger.logged("Request timed out") {
+		t.Error("client disconnect was logged as a timeout")
+	}
+}
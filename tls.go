@@ -0,0 +1,231 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+const defaultTLSReloadInterval = 10 * time.Second
+
+// TLSConfig contains the parameters for serving the API over TLS
+type TLSConfig struct {
+	// CertFile and KeyFile contain the PEM encoded certificate and key.
+	// Setting them makes ListenAndServe and Serve use TLS.
+	CertFile string
+	KeyFile  string `smolder:"secret"`
+	// ClientCAFile contains the PEM encoded CAs used to verify client
+	// certificates. Clients may then present a certificate.
+	ClientCAFile string
+	// RequireClientCert rejects clients without a valid certificate
+	RequireClientCert bool
+	// ReloadInterval determines how often the files are checked for changes,
+	// defaults to 10s. A negative value disables polling, the files still
+	// get reloaded on SIGHUP.
+	ReloadInterval time.Duration
+}
+
+// enabled returns whether the API should be served over TLS
+func (c TLSConfig) enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// ClientCertificateSetter can optionally be implemented by an APIContext to
+// receive the verified certificate of a TLS client
+type ClientCertificateSetter interface {
+	SetClientCertificate(cert *x509.Certificate)
+}
+
+// ClientCertificate returns the verified certificate the client presented,
+// or nil if it didn't present one
+func ClientCertificate(request *restful.Request) *x509.Certificate {
+	state := request.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return state.VerifiedChains[0][0]
+}
+
+// certReloader keeps the TLS configuration in sync with the files on disk.
+// Established connections keep using the configuration they were created
+// with, only new handshakes see a reloaded certificate.
+type certReloader struct {
+	config TLSConfig
+	logger Logger
+
+	mu        sync.RWMutex
+	tlsConfig *tls.Config
+	modTimes  map[string]time.Time
+
+	done chan struct{}
+}
+
+func newCertReloader(config TLSConfig, logger Logger) (*certReloader, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, errors.New("TLS requires both a certificate and a key file")
+	}
+	if config.RequireClientCert && config.ClientCAFile == "" {
+		return nil, errors.New("Requiring client certificates needs a ClientCAFile")
+	}
+
+	cr := &certReloader{
+		config: config,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// baseConfig returns the tls.Config handing out the current configuration
+// on every handshake
+func (cr *certReloader) baseConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &cr.current().Certificates[0], nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return cr.current(), nil
+		},
+	}
+}
+
+func (cr *certReloader) current() *tls.Config {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	return cr.tlsConfig
+}
+
+// files returns the paths of all files the configuration is loaded from
+func (cr *certReloader) files() []string {
+	files := []string{cr.config.CertFile, cr.config.KeyFile}
+	if cr.config.ClientCAFile != "" {
+		files = append(files, cr.config.ClientCAFile)
+	}
+	return files
+}
+
+// reload loads the certificate, key and client CAs. On failure the previous
+// configuration stays in place.
+func (cr *certReloader) reload() error {
+	modTimes := make(map[string]time.Time)
+	for _, f := range cr.files() {
+		if fi, err := os.Stat(f); err == nil {
+			modTimes[f] = fi.ModTime()
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.config.CertFile, cr.config.KeyFile)
+	if err != nil {
+		return errors.New("Can't load TLS certificate: " + err.Error())
+	}
+
+	c := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if cr.config.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(cr.config.ClientCAFile)
+		if err != nil {
+			return errors.New("Can't load client CAs: " + err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("Can't load client CAs: no certificates found in " + cr.config.ClientCAFile)
+		}
+
+		c.ClientCAs = pool
+		c.ClientAuth = tls.VerifyClientCertIfGiven
+		if cr.config.RequireClientCert {
+			c.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	cr.mu.Lock()
+	cr.tlsConfig = c
+	cr.modTimes = modTimes
+	cr.mu.Unlock()
+
+	return nil
+}
+
+// changed returns whether any of the files were modified since they were
+// last loaded
+func (cr *certReloader) changed() bool {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	for _, f := range cr.files() {
+		fi, err := os.Stat(f)
+		if err != nil {
+			// the file may be in the middle of being replaced
+			continue
+		}
+		if !fi.ModTime().Equal(cr.modTimes[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads the configuration on SIGHUP or when the files change, until
+// stop gets called
+func (cr *certReloader) watch() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+
+	var tick <-chan time.Time
+	interval := cr.config.ReloadInterval
+	if interval == 0 {
+		interval = defaultTLSReloadInterval
+	}
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-cr.done:
+			return
+		case <-sigs:
+		case <-tick:
+			if !cr.changed() {
+				continue
+			}
+		}
+
+		if err := cr.reload(); err != nil {
+			cr.logger.WithFields(Fields{"Error": err}).Error("Reloading TLS certificate failed")
+			continue
+		}
+		cr.logger.WithFields(Fields{"CertFile": cr.config.CertFile}).Info("Reloaded TLS certificate")
+	}
+}
+
+func (cr *certReloader) stop() {
+	close(cr.done)
+}
@@ -0,0 +1,299 @@
+/*
+ * smolder
+ *     Copyright (c) 2016-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package smolder
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+// W3C trace context headers
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+
+	spanAttribute = "span"
+	flagSampled   = 0x01
+)
+
+type spanContextKey struct{}
+
+// TracingConfig contains the parameters for tracing requests
+type TracingConfig struct {
+	// Enabled creates a span for each request and propagates trace context
+	Enabled bool
+	// Exporter receives all finished, sampled spans
+	Exporter SpanExporter `json:"-"`
+}
+
+// SpanExporter receives finished spans, e.g. to send them to a tracing backend
+type SpanExporter interface {
+	ExportSpan(span SpanData)
+}
+
+// SpanData is the immutable record of a finished span
+type SpanData struct {
+	Name         string                 `json:"name"`
+	TraceID      string                 `json:"traceId"`
+	SpanID       string                 `json:"spanId"`
+	ParentSpanID string                 `json:"parentSpanId,omitempty"`
+	Start        time.Time              `json:"start"`
+	End          time.Time              `json:"end"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Span tracks a unit of work within a trace
+type Span struct {
+	name       string
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	flags      byte
+	traceState string
+	start      time.Time
+	exporter   SpanExporter
+
+	mu         sync.Mutex
+	attributes map[string]interface{}
+	finished   bool
+}
+
+func newSpan(name string, exporter SpanExporter) *Span {
+	span := &Span{
+		name:       name,
+		flags:      flagSampled,
+		start:      time.Now(),
+		exporter:   exporter,
+		attributes: make(map[string]interface{}),
+	}
+	randomBytes(span.traceID[:])
+	randomBytes(span.spanID[:])
+
+	return span
+}
+
+// TraceID returns the hex-encoded ID of the trace this span belongs to
+func (s *Span) TraceID() string {
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// SpanID returns the hex-encoded ID of this span
+func (s *Span) SpanID() string {
+	return hex.EncodeToString(s.spanID[:])
+}
+
+// Sampled returns whether this span will be exported
+func (s *Span) Sampled() bool {
+	return s.flags&flagSampled != 0
+}
+
+// SetAttribute attaches a key/value pair to the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attributes[key] = value
+}
+
+// StartChild starts a new span as a child of this span
+func (s *Span) StartChild(name string) *Span {
+	child := newSpan(name, s.exporter)
+	child.traceID = s.traceID
+	child.parentID = s.spanID
+	child.flags = s.flags
+	child.traceState = s.traceState
+
+	return child
+}
+
+// Finish ends the span and hands it to the exporter
+func (s *Span) Finish() {
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+	s.finished = true
+
+	data := SpanData{
+		Name:       s.name,
+		TraceID:    s.TraceID(),
+		SpanID:     s.SpanID(),
+		Start:      s.start,
+		End:        time.Now(),
+		Attributes: make(map[string]interface{}, len(s.attributes)),
+	}
+	if s.parentID != [8]byte{} {
+		data.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	for k, v := range s.attributes {
+		data.Attributes[k] = v
+	}
+	s.mu.Unlock()
+
+	if s.exporter != nil && s.Sampled() {
+		s.exporter.ExportSpan(data)
+	}
+}
+
+// TraceParent returns the span's context formatted as a W3C traceparent
+func (s *Span) TraceParent() string {
+	return "00-" + s.TraceID() + "-" + s.SpanID() + "-" + hex.EncodeToString([]byte{s.flags})
+}
+
+// Inject propagates the span's context to outgoing requests
+func (s *Span) Inject(header http.Header) {
+	header.Set(HeaderTraceParent, s.TraceParent())
+	if s.traceState != "" {
+		header.Set(HeaderTraceState, s.traceState)
+	}
+}
+
+// ContextWithSpan returns a copy of ctx carrying span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// SpanFromRequest returns the span tracing request, or nil
+func SpanFromRequest(request *restful.Request) *Span {
+	span, _ := request.Attribute(spanAttribute).(*Span)
+	return span
+}
+
+// parseTraceParent continues the trace of a valid W3C traceparent header
+func (s *Span) parseTraceParent(traceParent string) bool {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return false
+	}
+	if _, err := hex.DecodeString(parts[0]); err != nil {
+		return false
+	}
+
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != 16 || isZero(traceID) {
+		return false
+	}
+	parentID, err := hex.DecodeString(parts[2])
+	if err != nil || len(parentID) != 8 || isZero(parentID) {
+		return false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return false
+	}
+
+	copy(s.traceID[:], traceID)
+	copy(s.parentID[:], parentID)
+	s.flags = flags[0]
+	return true
+}
+
+func (s *Server) tracingFilter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	method := request.Request.Method
+	name := "HTTP " + method
+	if res := s.resourceName(method, request.SelectedRoutePath()); res != "" {
+		name = res + " " + method
+	}
+
+	span := newSpan(name, s.Config.Tracing.Exporter)
+	if span.parseTraceParent(request.Request.Header.Get(HeaderTraceParent)) {
+		span.traceState = request.Request.Header.Get(HeaderTraceState)
+	}
+	span.SetAttribute("http.method", method)
+	span.SetAttribute("http.route", routeTemplate(request))
+	span.SetAttribute("smolder.request_id", RequestID(request))
+	defer span.Finish()
+
+	request.SetAttribute(spanAttribute, span)
+	request.Request = request.Request.WithContext(ContextWithSpan(request.Request.Context(), span))
+	span.Inject(response.Header())
+
+	chain.ProcessFilter(request, response)
+	span.SetAttribute("http.status_code", response.StatusCode())
+}
+
+// WriterExporter writes finished spans as JSON lines, e.g. to os.Stdout
+type WriterExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewWriterExporter returns a SpanExporter writing to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{enc: json.NewEncoder(w)}
+}
+
+// ExportSpan writes span to the underlying writer
+func (e *WriterExporter) ExportSpan(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.enc.Encode(span)
+}
+
+// InMemoryExporter collects finished spans, mostly useful for tests
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// ExportSpan records span
+func (e *InMemoryExporter) ExportSpan(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns all recorded spans
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset drops all recorded spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans = nil
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+}